@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+type assembleOptions struct {
+	filesDir   string
+	signKey    string
+	passphrase passphraseSource
+	clean      bool
+	yes        bool
+}
+
+func newAssembleCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build assemble", flag.ExitOnError)
+	var opts assembleOptions
+	flags.StringVar(&opts.filesDir, "files", "", "Directory of files for the root of the mod folder, such as mod.cpp, meta.cpp and logos (optional)")
+	flags.StringVar(&opts.signKey, "sign", "", "Path to a .biprivatekey to sign the PBOs with (optional)")
+	opts.passphrase.register(flags)
+	flags.BoolVar(&opts.clean, "clean", false, "Delete files in the mod folder which are not part of the assembly, such as PBOs of removed addons")
+	flags.BoolVar(&opts.yes, "yes", false, "Automatically confirm all prompts (use with caution)")
+
+	return &ffcli.Command{
+		Name:       "assemble",
+		ShortUsage: "mod-build assemble [options] <mod-folder> <addon-directory>...",
+		ShortHelp:  "Assemble built addons into a mod folder for release",
+		LongHelp: "Assemble built addons into a mod folder for release: each addon is packed to\n" +
+			"addons/<addon name>.pbo and signed, the public key is written to keys/, and\n" +
+			"the files for the root of the mod folder, such as mod.cpp, are copied. The\n" +
+			"mod folder has a build manifest, so unchanged addons are not packed again.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "error: mod folder and at least one addon directory are required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return assembleMod(args[0], args[1:], opts)
+		},
+	}
+}
+
+// assembledAddon is a built addon which is packed into the mod folder.
+type assembledAddon struct {
+	dir      string
+	output   *Output
+	manifest Manifest
+	prefix   string
+	// pboPath is the path of the PBO in the mod folder
+	pboPath string
+	// sourceHash identifies the contents of the built addon
+	sourceHash string
+}
+
+func assembleMod(modDir string, addonDirs []string, opts assembleOptions) error {
+	var signKey *BIPrivateKey
+	var publicKey []byte
+	if opts.signKey != "" {
+		var err error
+		signKey, err = readBIPrivateKeyFile(opts.signKey, opts.passphrase)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = EncodeBIKey(&buf, signKey.Public())
+		if err != nil {
+			return err
+		}
+		publicKey = buf.Bytes()
+	}
+
+	manifest := make(Manifest)
+	var addons []assembledAddon
+	for _, dir := range addonDirs {
+		addon, err := loadAssembledAddon(dir)
+		if err != nil {
+			return err
+		}
+		if _, ok := manifest[addon.pboPath]; ok {
+			return fmt.Errorf("error: more than one addon is packed to %q", addon.pboPath)
+		}
+		addons = append(addons, addon)
+		manifest[addon.pboPath] = ManifestEntry{SourcePath: addon.pboPath, OutputPath: addon.pboPath}
+		if signKey != nil {
+			path := bisignPath(addon.pboPath, signKey.Authority)
+			manifest[path] = ManifestEntry{SourcePath: path, OutputPath: path}
+		}
+	}
+	keyPath := ""
+	if signKey != nil {
+		keyPath = "keys/" + signKey.Authority + ".bikey"
+		manifest[keyPath] = ManifestEntry{SourcePath: keyPath, SourceHash: hashData(publicKey), OutputPath: keyPath, OutputHash: hashData(publicKey)}
+	}
+
+	var files *Source
+	var filePaths []string
+	if opts.filesDir != "" {
+		files = NewSource(opts.filesDir)
+		err := files.EnsureValid()
+		if err != nil {
+			return err
+		}
+		err = fs.WalkDir(os.DirFS(opts.filesDir), ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if _, ok := manifest[path]; ok {
+				return fmt.Errorf("error: %q in %q is also assembled from the addons", path, opts.filesDir)
+			}
+			hash, err := files.hash(path)
+			if err != nil {
+				return err
+			}
+			filePaths = append(filePaths, path)
+			manifest[path] = ManifestEntry{SourcePath: path, SourceHash: hash, OutputPath: path, OutputHash: hash}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := manifest["mod.cpp"]; !ok {
+		fmt.Fprintf(os.Stderr, "⚠️ No mod.cpp, the launcher will show the mod folder name without a logo\n")
+	}
+
+	modOutput := NewOutput(modDir)
+	err := modOutput.EnsureExists()
+	if err != nil {
+		return err
+	}
+	confirm, err := yesOrNo(opts.yes, fmt.Sprintf("⚠️ The contents of %q will be removed or replaced. Continue? [y/N] ", modDir))
+	if err != nil {
+		return err
+	}
+	if !confirm {
+		return nil
+	}
+
+	previous, err := modOutput.LoadManifest()
+	if err != nil {
+		return err
+	}
+	// the payload copied by builds with -mod is kept
+	for path, entry := range previous {
+		if strings.HasPrefix(path, "_") {
+			manifest[path] = entry
+		}
+	}
+
+	if opts.clean {
+		// only files recorded by earlier assemblies are deleted, the mod
+		// folder may hold others, such as PBOs packed into it by builds
+		for _, path := range modOutput.PathsToCleanFromPrevious(previous, manifest) {
+			fmt.Printf("🧹 Deleting   : %q\n", path)
+			err = modOutput.Remove(path)
+			if err != nil {
+				return err
+			}
+			modOutput.RemoveEmptyParents(path)
+		}
+	}
+
+	for _, addon := range addons {
+		entry := manifest[addon.pboPath]
+		entry.SourceHash = addon.sourceHash
+		if isUnchanged(modOutput, addon.pboPath, entry.SourceHash, previous[addon.pboPath].SourceHash, previous[addon.pboPath].OutputHash) {
+			fmt.Printf("⏭️ Unchanged  : %q\n", addon.pboPath)
+			entry.OutputHash = previous[addon.pboPath].OutputHash
+		} else {
+			fmt.Printf("📦 Packing    : %q -> %q\n", addon.dir, addon.pboPath)
+			err = addon.output.Pack(filepath.Join(modDir, addon.pboPath), addon.prefix, addon.manifest)
+			if err != nil {
+				return err
+			}
+			entry.OutputHash, err = modOutput.Hash(addon.pboPath)
+			if err != nil {
+				return err
+			}
+		}
+		manifest[addon.pboPath] = entry
+
+		if signKey == nil {
+			continue
+		}
+		path := bisignPath(addon.pboPath, signKey.Authority)
+		signature := manifest[path]
+		// the signature depends on the PBO and the key
+		signature.SourceHash = hashData(append([]byte(entry.OutputHash), publicKey...))
+		if isUnchanged(modOutput, path, signature.SourceHash, previous[path].SourceHash, previous[path].OutputHash) {
+			fmt.Printf("⏭️ Unchanged  : %q\n", path)
+			signature.OutputHash = previous[path].OutputHash
+		} else {
+			fmt.Printf("✍️ Signing    : %q\n", addon.pboPath)
+			_, err = signPBOFile(filepath.Join(modDir, addon.pboPath), signKey)
+			if err != nil {
+				return err
+			}
+			signature.OutputHash, err = modOutput.Hash(path)
+			if err != nil {
+				return err
+			}
+		}
+		manifest[path] = signature
+	}
+
+	if keyPath != "" {
+		if isUnchanged(modOutput, keyPath, manifest[keyPath].SourceHash, previous[keyPath].SourceHash, previous[keyPath].OutputHash) {
+			fmt.Printf("⏭️ Unchanged  : %q\n", keyPath)
+		} else {
+			fmt.Printf("🔑 Writing    : %q\n", keyPath)
+			_, err = modOutput.Write(keyPath, publicKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, path := range filePaths {
+		entry := manifest[path]
+		if isUnchanged(modOutput, path, entry.SourceHash, previous[path].SourceHash, previous[path].OutputHash) {
+			fmt.Printf("⏭️ Unchanged  : %q\n", path)
+			continue
+		}
+		fmt.Printf("📄 Copying    : %q\n", path)
+		err = modOutput.Copy(files.RealPath(path), path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return modOutput.WriteManifest(manifest)
+}
+
+// loadAssembledAddon reads the build manifest and prefix of the built addon
+// in dir.
+func loadAssembledAddon(dir string) (assembledAddon, error) {
+	addon := assembledAddon{dir: dir, output: NewOutput(dir)}
+	finfo, err := os.Stat(dir)
+	if err != nil {
+		return addon, err
+	}
+	if !finfo.IsDir() {
+		return addon, fmt.Errorf("error: path %q exists but is not a directory", dir)
+	}
+
+	addon.manifest, err = addon.output.LoadManifest()
+	if err != nil {
+		return addon, err
+	}
+	if len(addon.manifest) == 0 {
+		return addon, fmt.Errorf("error: %q has no build manifest, build the addon first", dir)
+	}
+
+	addon.prefix, err = addon.output.Prefix()
+	if err != nil {
+		return addon, err
+	}
+	name := prefixName(addon.prefix)
+	if addon.prefix == "" {
+		fmt.Fprintf(os.Stderr, "⚠️ No %s found in %q, packing without a prefix\n", prefixFile, dir)
+		name = filepath.Base(filepath.Clean(dir))
+	}
+	addon.pboPath = "addons/" + name + ".pbo"
+	addon.sourceHash = manifestHash(addon.manifest, addon.prefix)
+	return addon, nil
+}
+
+// manifestHash returns a hash of the entries of manifest and prefix, which
+// changes whenever an output of the build does.
+func manifestHash(manifest Manifest, prefix string) string {
+	paths := make([]string, 0, len(manifest))
+	for path := range manifest {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.WriteString(prefix + "\n")
+	for _, path := range paths {
+		entry := manifest[path]
+		fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\n", path, entry.SourceHash, entry.OutputPath, entry.OutputHash)
+	}
+	return hashData(buf.Bytes())
+}
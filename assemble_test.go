@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBuiltAddon(t *testing.T, prefix, config string) string {
+	t.Helper()
+	return testFiles(t, map[string]string{
+		prefixFile:        prefix,
+		"config.cpp":      config,
+		".build.manifest": "config.cpp\t" + hashData([]byte(config)) + "\n",
+	})
+}
+
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	require.NoError(t, filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	}))
+	sort.Strings(files)
+	return files
+}
+
+func TestAssembleMod(t *testing.T) {
+	keysDir := t.TempDir()
+	require.NoError(t, keygen("WLZ", keysDir, nil))
+	core := testBuiltAddon(t, `WLZ\Core`, "class Core {};")
+	items := testBuiltAddon(t, `WLZ\Items`, "class Items {};")
+	files := testFiles(t, map[string]string{"mod.cpp": `name = "WLZ";`, "images/logo.paa": "logo"})
+	modDir := t.TempDir()
+	opts := assembleOptions{filesDir: files, signKey: filepath.Join(keysDir, "WLZ.biprivatekey"), yes: true}
+
+	require.NoError(t, assembleMod(modDir, []string{core, items}, opts))
+	assert.Equal(t, []string{
+		".build.manifest",
+		"addons/WLZ_Core.pbo",
+		"addons/WLZ_Core.pbo.WLZ.bisign",
+		"addons/WLZ_Items.pbo",
+		"addons/WLZ_Items.pbo.WLZ.bisign",
+		"images/logo.paa",
+		"keys/WLZ.bikey",
+		"mod.cpp",
+	}, listFiles(t, modDir))
+	require.NoError(t, verifySignatures(modDir, nil))
+
+	t.Run("unchanged addons are not packed again", func(t *testing.T) {
+		pboPath := filepath.Join(modDir, "addons", "WLZ_Core.pbo")
+		before, err := os.Stat(pboPath)
+		require.NoError(t, err)
+		require.NoError(t, os.Chtimes(pboPath, before.ModTime().Add(-time.Hour), before.ModTime().Add(-time.Hour)))
+
+		require.NoError(t, assembleMod(modDir, []string{core, items}, opts))
+		after, err := os.Stat(pboPath)
+		require.NoError(t, err)
+		assert.Equal(t, before.ModTime().Add(-time.Hour), after.ModTime())
+	})
+
+	t.Run("changed addons are packed and signed again", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(core, "config.cpp"), []byte("class Core2 {};"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(core, ".build.manifest"), []byte("config.cpp\t"+hashData([]byte("class Core2 {};"))+"\n"), 0644))
+
+		require.NoError(t, assembleMod(modDir, []string{core, items}, opts))
+		require.NoError(t, verifySignatures(modDir, nil))
+	})
+
+	t.Run("clean removes removed addons and keeps other files", func(t *testing.T) {
+		manifest, err := NewOutput(modDir).LoadManifest()
+		require.NoError(t, err)
+		manifest["_docs/README.txt"] = ManifestEntry{SourcePath: "_docs/README.txt", SourceHash: hashData([]byte("docs")), OutputPath: "docs/README.txt", OutputHash: hashData([]byte("docs"))}
+		require.NoError(t, NewOutput(modDir).WriteManifest(manifest))
+		_, err = NewOutput(modDir).Write("docs/README.txt", []byte("docs"))
+		require.NoError(t, err)
+		// packed into the mod folder by a build with -pack
+		_, err = NewOutput(modDir).Write("addons/x.pbo", []byte("pbo"))
+		require.NoError(t, err)
+
+		opts := opts
+		opts.clean = true
+		require.NoError(t, assembleMod(modDir, []string{items}, opts))
+		assert.Equal(t, []string{
+			".build.manifest",
+			"addons/WLZ_Items.pbo",
+			"addons/WLZ_Items.pbo.WLZ.bisign",
+			"addons/x.pbo",
+			"docs/README.txt",
+			"images/logo.paa",
+			"keys/WLZ.bikey",
+			"mod.cpp",
+		}, listFiles(t, modDir))
+	})
+
+	t.Run("addons with the same name", func(t *testing.T) {
+		assert.ErrorContains(t, assembleMod(t.TempDir(), []string{items, items}, opts), "more than one addon")
+	})
+
+	t.Run("addon which is not built", func(t *testing.T) {
+		assert.ErrorContains(t, assembleMod(t.TempDir(), []string{t.TempDir()}, opts), "no build manifest")
+	})
+}
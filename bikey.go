@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// biKeyBits is the size of the keys made by DSCreateKey, which the game
+// expects.
+const biKeyBits = 1024
+
+// biKeyMinBits and biKeyMaxBits bound the size of the keys which are read,
+// so a corrupt or crafted key can't make us allocate and compute with huge
+// numbers.
+const (
+	biKeyMinBits = 512
+	biKeyMaxBits = 16384
+)
+
+const (
+	biPublicKeyBlob  = 0x06
+	biPrivateKeyBlob = 0x07
+	biBlobVersion    = 0x02
+	biKeyAlgorithm   = 0x2400 // CALG_RSA_SIGN
+)
+
+// BIKey is a public key in the .bikey format, which servers use to check
+// the signatures of addons.
+type BIKey struct {
+	Authority string
+	Key       *rsa.PublicKey
+}
+
+// BIPrivateKey is a private key in the .biprivatekey format, which addons
+// are signed with.
+type BIPrivateKey struct {
+	Authority string
+	Key       *rsa.PrivateKey
+}
+
+// GenerateBIKey returns a new private key for authority.
+func GenerateBIKey(authority string) (*BIPrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, biKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	return &BIPrivateKey{Authority: authority, Key: key}, nil
+}
+
+// Public returns the public key of k.
+func (k *BIPrivateKey) Public() *BIKey {
+	return &BIKey{Authority: k.Authority, Key: &k.Key.PublicKey}
+}
+
+// EncodeBIKey writes key as a .bikey: the authority name, then the key as a
+// Microsoft PUBLICKEYBLOB with the numbers in little endian order.
+func EncodeBIKey(w io.Writer, key *BIKey) error {
+	bits := key.Key.N.BitLen()
+	var blob bytes.Buffer
+	writeBIKeyHeader(&blob, biPublicKeyBlob, "RSA1", bits, key.Key.E)
+	blob.Write(littleEndian(key.Key.N, bits/8))
+	return writeBIKeyFile(w, key.Authority, blob.Bytes())
+}
+
+// EncodeBIPrivateKey writes key as a .biprivatekey: the authority name, then
+// the key as a Microsoft PRIVATEKEYBLOB with the numbers in little endian
+// order.
+func EncodeBIPrivateKey(w io.Writer, key *BIPrivateKey) error {
+	if len(key.Key.Primes) != 2 {
+		return fmt.Errorf("key has %d primes, not 2", len(key.Key.Primes))
+	}
+	key.Key.Precompute()
+
+	bits := key.Key.N.BitLen()
+	var blob bytes.Buffer
+	writeBIKeyHeader(&blob, biPrivateKeyBlob, "RSA2", bits, key.Key.E)
+	blob.Write(littleEndian(key.Key.N, bits/8))
+	blob.Write(littleEndian(key.Key.Primes[0], bits/16))
+	blob.Write(littleEndian(key.Key.Primes[1], bits/16))
+	blob.Write(littleEndian(key.Key.Precomputed.Dp, bits/16))
+	blob.Write(littleEndian(key.Key.Precomputed.Dq, bits/16))
+	blob.Write(littleEndian(key.Key.Precomputed.Qinv, bits/16))
+	blob.Write(littleEndian(key.Key.D, bits/8))
+	return writeBIKeyFile(w, key.Authority, blob.Bytes())
+}
+
+func writeBIKeyHeader(blob *bytes.Buffer, blobType byte, magic string, bits, exponent int) {
+	blob.Write([]byte{blobType, biBlobVersion, 0, 0})
+	_ = binary.Write(blob, binary.LittleEndian, uint32(biKeyAlgorithm))
+	blob.WriteString(magic)
+	_ = binary.Write(blob, binary.LittleEndian, uint32(bits))
+	_ = binary.Write(blob, binary.LittleEndian, uint32(exponent))
+}
+
+func writeBIKeyFile(w io.Writer, authority string, blob []byte) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(authority)
+	buf.WriteByte(0)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(blob)))
+	buf.Write(blob)
+	return buf.Flush()
+}
+
+// DecodeBIKey reads a .bikey.
+func DecodeBIKey(r io.Reader) (*BIKey, error) {
+	authority, blob, err := readBIKeyFile(r, biPublicKeyBlob, "RSA1")
+	if err != nil {
+		return nil, err
+	}
+	n, err := blob.number(blob.bits / 8)
+	if err != nil {
+		return nil, err
+	}
+	return &BIKey{Authority: authority, Key: &rsa.PublicKey{N: n, E: blob.exponent}}, nil
+}
+
+// DecodeBIPrivateKey reads a .biprivatekey.
+func DecodeBIPrivateKey(r io.Reader) (*BIPrivateKey, error) {
+	authority, blob, err := readBIKeyFile(r, biPrivateKeyBlob, "RSA2")
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers [7]*big.Int
+	for i, size := range []int{8, 16, 16, 16, 16, 16, 8} {
+		numbers[i], err = blob.number(blob.bits / size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: numbers[0], E: blob.exponent},
+		D:         numbers[6],
+		Primes:    []*big.Int{numbers[1], numbers[2]},
+	}
+	err = key.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	key.Precompute()
+	return &BIPrivateKey{Authority: authority, Key: key}, nil
+}
+
+type biKeyBlob struct {
+	r        *bufio.Reader
+	bits     int
+	exponent int
+}
+
+func (b *biKeyBlob) number(size int) (*big.Int, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(b.r, data)
+	if err != nil {
+		return nil, fmt.Errorf("truncated key: %w", err)
+	}
+	return new(big.Int).SetBytes(reverseBytes(data)), nil
+}
+
+func readBIKeyFile(r io.Reader, blobType byte, magic string) (string, *biKeyBlob, error) {
+	buf := bufio.NewReader(r)
+	authority, err := readCString(buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading authority: %w", err)
+	}
+	var size uint32
+	err = binary.Read(buf, binary.LittleEndian, &size)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading key size: %w", err)
+	}
+
+	header := make([]byte, 20)
+	_, err = io.ReadFull(buf, header)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading key header: %w", err)
+	}
+	if header[0] != blobType || header[1] != biBlobVersion || string(header[8:12]) != magic {
+		return "", nil, errors.New("not a key of the expected type")
+	}
+	bits := int(binary.LittleEndian.Uint32(header[12:16]))
+	if bits < biKeyMinBits || bits > biKeyMaxBits || bits%16 != 0 {
+		return "", nil, fmt.Errorf("unsupported key size of %d bits", bits)
+	}
+	// the modulus, and for private keys the primes, the CRT values and the
+	// private exponent, follow the header
+	expected := 20 + bits/8
+	if blobType == biPrivateKeyBlob {
+		expected = 20 + bits/8*2 + bits/16*5
+	}
+	if int(size) != expected {
+		return "", nil, fmt.Errorf("key of %d bits is %d bytes, not %d", bits, size, expected)
+	}
+	exponent := int(binary.LittleEndian.Uint32(header[16:20]))
+	return authority, &biKeyBlob{r: buf, bits: bits, exponent: exponent}, nil
+}
+
+// littleEndian returns n as size bytes in little endian order.
+func littleEndian(n *big.Int, size int) []byte {
+	return reverseBytes(n.FillBytes(make([]byte, size)))
+}
+
+// reverseBytes reverses data in place and returns it.
+func reverseBytes(data []byte) []byte {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	return data
+}
+
+func newKeygenCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build keygen", flag.ExitOnError)
+	outputDir := flags.String("output", ".", "Directory to write the key pair to")
+	encrypt := flags.Bool("encrypt", false, "Encrypt the private key with a passphrase")
+	var passphrase passphraseSource
+	passphrase.register(flags)
+
+	return &ffcli.Command{
+		Name:       "keygen",
+		ShortUsage: "mod-build keygen [options] <authority>",
+		ShortHelp:  "Create a key pair for signing PBOs",
+		LongHelp: "Create a key pair for signing PBOs, like DSCreateKey. The private key is\n" +
+			"written to <authority>.biprivatekey and the public key, which servers use to\n" +
+			"check signatures, to <authority>.bikey. Existing keys are not overwritten.\n" +
+			"With -encrypt, the private key is encrypted with a passphrase.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || args[0] == "" {
+				fmt.Fprintln(os.Stderr, "error: authority name is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			var secret []byte
+			if *encrypt {
+				// refuse before asking for a passphrase which won't be used
+				_, _, err := keygenPaths(args[0], *outputDir)
+				if err != nil {
+					return err
+				}
+				secret, err = passphrase.Read(args[0]+".biprivatekey", true)
+				if err != nil {
+					return err
+				}
+			}
+			return keygen(args[0], *outputDir, secret)
+		},
+	}
+}
+
+// keygen writes a new key pair for authority to outputDir, encrypting the
+// private key with passphrase unless it is nil.
+func keygen(authority, outputDir string, passphrase []byte) error {
+	privatePath, publicPath, err := keygenPaths(authority, outputDir)
+	if err != nil {
+		return err
+	}
+
+	key, err := GenerateBIKey(authority)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔑 Writing    : %q\n", privatePath)
+	err = writeKeyFile(privatePath, 0600, func(w io.Writer) error {
+		if passphrase == nil {
+			return EncodeBIPrivateKey(w, key)
+		}
+		data, err := EncryptBIPrivateKey(key, passphrase)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔑 Writing    : %q\n", publicPath)
+	return writeKeyFile(publicPath, 0644, func(w io.Writer) error { return EncodeBIKey(w, key.Public()) })
+}
+
+// keygenPaths returns the paths of the private and public key of authority
+// in outputDir, and an error if either already exists.
+func keygenPaths(authority, outputDir string) (string, string, error) {
+	if strings.ContainsAny(authority, `/\:`) {
+		return "", "", fmt.Errorf("error: authority %q must not contain path separators", authority)
+	}
+
+	privatePath := filepath.Join(outputDir, authority+".biprivatekey")
+	publicPath := filepath.Join(outputDir, authority+".bikey")
+	for _, path := range []string{privatePath, publicPath} {
+		_, err := os.Stat(path)
+		if err == nil {
+			return "", "", fmt.Errorf("error: %q already exists", path)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+	}
+	return privatePath, publicPath, nil
+}
+
+func writeKeyFile(path string, perm os.FileMode, encode func(w io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = encode(f)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
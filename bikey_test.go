@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBIKey(t *testing.T) {
+	key, err := GenerateBIKey("WLZ")
+	require.NoError(t, err)
+
+	t.Run("public key layout", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBIKey(&buf, key.Public()))
+		data := buf.Bytes()
+
+		require.Len(t, data, 4+4+20+128)
+		assert.Equal(t, []byte("WLZ\x00"), data[:4])
+		assert.Equal(t, uint32(148), binary.LittleEndian.Uint32(data[4:]))
+		assert.Equal(t, []byte{0x06, 0x02, 0x00, 0x00, 0x00, 0x24, 0x00, 0x00}, data[8:16])
+		assert.Equal(t, "RSA1", string(data[16:20]))
+		assert.Equal(t, uint32(1024), binary.LittleEndian.Uint32(data[20:]))
+		assert.Equal(t, uint32(65537), binary.LittleEndian.Uint32(data[24:]))
+		assert.Equal(t, littleEndian(key.Key.N, 128), data[28:])
+	})
+
+	t.Run("public key round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBIKey(&buf, key.Public()))
+		decoded, err := DecodeBIKey(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, "WLZ", decoded.Authority)
+		assert.True(t, key.Key.PublicKey.Equal(decoded.Key))
+	})
+
+	t.Run("private key round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBIPrivateKey(&buf, key))
+		assert.Equal(t, 4+4+20+128*2+64*5, buf.Len())
+		assert.Equal(t, "RSA2", string(buf.Bytes()[16:20]))
+
+		decoded, err := DecodeBIPrivateKey(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, "WLZ", decoded.Authority)
+		assert.True(t, key.Key.Equal(decoded.Key))
+	})
+
+	t.Run("wrong key type", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBIKey(&buf, key.Public()))
+		_, err := DecodeBIPrivateKey(&buf)
+		assert.Error(t, err)
+	})
+
+	t.Run("truncated key", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBIKey(&buf, key.Public()))
+		_, err := DecodeBIKey(bytes.NewReader(buf.Bytes()[:100]))
+		assert.Error(t, err)
+	})
+
+	t.Run("key sizes out of range", func(t *testing.T) {
+		for _, bits := range []uint32{256, 1 << 31} {
+			var buf bytes.Buffer
+			require.NoError(t, EncodeBIKey(&buf, key.Public()))
+			data := buf.Bytes()
+			binary.LittleEndian.PutUint32(data[20:], bits)
+			_, err := DecodeBIKey(bytes.NewReader(data))
+			assert.ErrorContains(t, err, "unsupported key size")
+		}
+	})
+
+	t.Run("blob length which does not match the key size", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBIKey(&buf, key.Public()))
+		data := buf.Bytes()
+		binary.LittleEndian.PutUint32(data[20:], 2048)
+		_, err := DecodeBIKey(bytes.NewReader(data))
+		assert.ErrorContains(t, err, "key of 2048 bits is 148 bytes, not 276")
+	})
+}
+
+func TestKeygen(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, keygen("WLZ", dir, nil))
+
+	f, err := os.Open(filepath.Join(dir, "WLZ.biprivatekey"))
+	require.NoError(t, err)
+	defer f.Close()
+	private, err := DecodeBIPrivateKey(f)
+	require.NoError(t, err)
+
+	f, err = os.Open(filepath.Join(dir, "WLZ.bikey"))
+	require.NoError(t, err)
+	defer f.Close()
+	public, err := DecodeBIKey(f)
+	require.NoError(t, err)
+	assert.True(t, private.Key.PublicKey.Equal(public.Key))
+
+	assert.ErrorContains(t, keygen("WLZ", dir, nil), "already exists")
+	assert.Error(t, keygen(`..\WLZ`, dir, nil))
+}
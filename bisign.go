@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// biSignatureVersion is the version of the signatures made by DSSignFile
+// for DayZ.
+const biSignatureVersion = 3
+
+// biSignatureExtensions are the extensions of the files whose contents are
+// covered by a version 3 signature. Other files are only covered by name.
+var biSignatureExtensions = []string{"sqf", "inc", "bikb", "ext", "fsm", "sqm", "hpp", "cfg", "sqs", "h", "sqfc"}
+
+// biSignatureV2Exclude are the extensions of the files whose contents are
+// not covered by a version 2 signature, as older tools still make them.
+var biSignatureV2Exclude = []string{"paa", "jpg", "p3d", "tga", "rvmat", "lip", "ogg", "wss", "png", "rtm", "pac", "fxy", "wrp"}
+
+// BISignature is a .bisign: the signer's public key and three signatures,
+// of the PBO checksum, and of the file names combined with the checksum and
+// with the contents of the script files. Signatures are in big endian order.
+type BISignature struct {
+	Key        *BIKey
+	Version    uint32
+	Signatures [3][]byte
+}
+
+// biSignatureHashes returns the three hashes which are signed for pbo by a
+// signature of version.
+func biSignatureHashes(pbo *PBOReader, version uint32) ([3][]byte, error) {
+	if version != 2 && version != 3 {
+		return [3][]byte{}, fmt.Errorf("unsupported signature version %d", version)
+	}
+
+	checksum, err := pbo.Checksum()
+	if err != nil {
+		return [3][]byte{}, err
+	}
+
+	order := make([]int, len(pbo.Entries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return strings.Compare(strings.ToLower(pbo.Entries[a].Name), strings.ToLower(pbo.Entries[b].Name))
+	})
+
+	names := sha1.New()
+	files := sha1.New()
+	hashedFiles := false
+	for _, i := range order {
+		entry := pbo.Entries[i]
+		size := entry.DataSize
+		if entry.PackingMethod == pboMethodCompressed {
+			size = entry.OriginalSize
+		}
+		if size == 0 {
+			continue
+		}
+		name := strings.ToLower(entry.Name)
+		names.Write([]byte(name))
+
+		ext := strings.TrimPrefix(path.Ext(strings.ReplaceAll(name, `\`, "/")), ".")
+		if version == 3 && !slices.Contains(biSignatureExtensions, ext) ||
+			version == 2 && slices.Contains(biSignatureV2Exclude, ext) {
+			continue
+		}
+		data, err := pbo.ReadFile(i)
+		if err != nil {
+			return [3][]byte{}, err
+		}
+		files.Write(data)
+		hashedFiles = true
+	}
+	if !hashedFiles && version == 3 {
+		files.Write([]byte("gnaP"))
+	} else if !hashedFiles {
+		files.Write([]byte("nothing"))
+	}
+	nameHash := names.Sum(nil)
+	fileHash := files.Sum(nil)
+
+	prefix := pbo.Prefix()
+	if prefix != "" && !strings.HasSuffix(prefix, `\`) {
+		prefix += `\`
+	}
+
+	hash2 := sha1.New()
+	hash2.Write(checksum)
+	hash2.Write(nameHash)
+	hash2.Write([]byte(prefix))
+
+	hash3 := sha1.New()
+	hash3.Write(fileHash)
+	hash3.Write(nameHash)
+	hash3.Write([]byte(prefix))
+
+	return [3][]byte{checksum, hash2.Sum(nil), hash3.Sum(nil)}, nil
+}
+
+// SignPBO returns the signature of pbo made with key.
+func SignPBO(pbo *PBOReader, key *BIPrivateKey) (*BISignature, error) {
+	hashes, err := biSignatureHashes(pbo, biSignatureVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := &BISignature{Key: key.Public(), Version: biSignatureVersion}
+	for i, hash := range hashes {
+		signature.Signatures[i], err = rsa.SignPKCS1v15(nil, key.Key, crypto.SHA1, hash)
+		if err != nil {
+			return nil, fmt.Errorf("error signing: %w", err)
+		}
+	}
+	return signature, nil
+}
+
+// EncodeBISignature writes signature as a .bisign: the public key as in a
+// .bikey, followed by the signatures in little endian order, each after its
+// length, with the version between the first and second.
+func EncodeBISignature(w io.Writer, signature *BISignature) error {
+	buf := bufio.NewWriter(w)
+	err := EncodeBIKey(buf, signature.Key)
+	if err != nil {
+		return err
+	}
+
+	size := signature.Key.Key.Size()
+	for i, data := range signature.Signatures {
+		if i == 1 {
+			_ = binary.Write(buf, binary.LittleEndian, signature.Version)
+		}
+		_ = binary.Write(buf, binary.LittleEndian, uint32(size))
+		buf.Write(littleEndian(new(big.Int).SetBytes(data), size))
+	}
+	return buf.Flush()
+}
+
+// DecodeBISignature reads a .bisign.
+func DecodeBISignature(r io.Reader) (*BISignature, error) {
+	buf := bufio.NewReader(r)
+	key, err := DecodeBIKey(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := &BISignature{Key: key}
+	for i := range signature.Signatures {
+		if i == 1 {
+			err = binary.Read(buf, binary.LittleEndian, &signature.Version)
+			if err != nil {
+				return nil, fmt.Errorf("error reading signature version: %w", err)
+			}
+		}
+		var size uint32
+		err = binary.Read(buf, binary.LittleEndian, &size)
+		if err != nil {
+			return nil, fmt.Errorf("error reading signature: %w", err)
+		}
+		if int(size) != key.Key.Size() {
+			return nil, fmt.Errorf("signature is %d bytes, not %d", size, key.Key.Size())
+		}
+		data := make([]byte, size)
+		_, err = io.ReadFull(buf, data)
+		if err != nil {
+			return nil, fmt.Errorf("truncated signature: %w", err)
+		}
+		signature.Signatures[i] = reverseBytes(data)
+	}
+	return signature, nil
+}
+
+// Verify reports whether signature is a valid signature of pbo.
+func (s *BISignature) Verify(pbo *PBOReader) (bool, error) {
+	hashes, err := biSignatureHashes(pbo, s.Version)
+	if err != nil {
+		return false, err
+	}
+	for i, hash := range hashes {
+		if rsa.VerifyPKCS1v15(s.Key.Key, crypto.SHA1, hash, s.Signatures[i]) != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// bisignPath returns the path of the signature of the PBO at pboPath made by
+// authority, next to the PBO.
+func bisignPath(pboPath, authority string) string {
+	return pboPath + "." + authority + ".bisign"
+}
+
+// signPBOFile signs the PBO at pboPath with key, and returns the path of the
+// signature.
+func signPBOFile(pboPath string, key *BIPrivateKey) (string, error) {
+	f, err := os.Open(pboPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	pbo, err := NewPBOReader(f)
+	if err != nil {
+		return "", fmt.Errorf("error reading %q: %w", pboPath, err)
+	}
+	signature, err := SignPBO(pbo, key)
+	if err != nil {
+		return "", fmt.Errorf("error signing %q: %w", pboPath, err)
+	}
+
+	dst := bisignPath(pboPath, key.Authority)
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	err = EncodeBISignature(out, signature)
+	if err != nil {
+		return "", err
+	}
+	return dst, out.Close()
+}
+
+// saveBIKey writes key to the .bikey at path, replacing it if it exists.
+func saveBIKey(path string, key *BIKey) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = EncodeBIKey(f, key)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPBO(t *testing.T, files map[string]string, prefix string) *PBOReader {
+	t.Helper()
+
+	names := slices.Sorted(maps.Keys(files))
+	var properties []PBOProperty
+	if prefix != "" {
+		properties = append(properties, PBOProperty{Key: "prefix", Value: prefix})
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, PackPBO(&buf, testFiles(t, files), names, properties))
+	pbo, err := NewPBOReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	return pbo
+}
+
+func sha1Sum(parts ...string) []byte {
+	hash := sha1.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+	}
+	return hash.Sum(nil)
+}
+
+func TestBISignatureHashes(t *testing.T) {
+	t.Run("names, scripts and prefix", func(t *testing.T) {
+		pbo := testPBO(t, map[string]string{
+			"config.cpp":       "class CfgPatches {};",
+			"Scripts/Init.SQF": "hint 1;",
+			"scripts/a.hpp":    "#define A",
+			"data/model.p3d":   "model",
+			"empty.sqf":        "",
+		}, `WLZ\Anniversary`)
+
+		hashes, err := biSignatureHashes(pbo, 3)
+		require.NoError(t, err)
+
+		checksum, err := pbo.Checksum()
+		require.NoError(t, err)
+		names := string(sha1Sum(`config.cpp`, `data\model.p3d`, `scripts\a.hpp`, `scripts\init.sqf`))
+		files := string(sha1Sum("#define A", "hint 1;"))
+
+		assert.Equal(t, checksum, hashes[0])
+		assert.Equal(t, sha1Sum(string(checksum), names, `WLZ\Anniversary\`), hashes[1])
+		assert.Equal(t, sha1Sum(files, names, `WLZ\Anniversary\`), hashes[2])
+	})
+
+	t.Run("no scripts and no prefix", func(t *testing.T) {
+		pbo := testPBO(t, map[string]string{"data/model.p3d": "model"}, "")
+
+		hashes, err := biSignatureHashes(pbo, 3)
+		require.NoError(t, err)
+
+		names := string(sha1Sum(`data\model.p3d`))
+		assert.Equal(t, sha1Sum(string(sha1Sum("gnaP")), names), hashes[2])
+	})
+}
+
+// TestBISignatureFixture checks against the files in testdata, which were
+// made without this package from the published PBO, key and signature
+// layouts: a PBO with entries out of order, mixed case names, an empty file
+// and a compressed script, its key pair and its version 3 signature.
+func TestBISignatureFixture(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "WLZ_Fixture.pbo"))
+	require.NoError(t, err)
+	pbo, err := NewPBOReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	bikey, err := os.Open(filepath.Join("testdata", "WLZ_Fixture.bikey"))
+	require.NoError(t, err)
+	defer bikey.Close()
+	key, err := DecodeBIKey(bikey)
+	require.NoError(t, err)
+
+	expected, err := os.ReadFile(filepath.Join("testdata", "WLZ_Fixture.pbo.WLZ_Fixture.bisign"))
+	require.NoError(t, err)
+	signature, err := DecodeBISignature(bytes.NewReader(expected))
+	require.NoError(t, err)
+	assert.Equal(t, key, signature.Key)
+	assert.Equal(t, uint32(3), signature.Version)
+
+	t.Run("hashes match", func(t *testing.T) {
+		hashes, err := biSignatureHashes(pbo, 3)
+		require.NoError(t, err)
+		assert.Equal(t, "a6aab53ebe21df1cfcf232ce406cff48666832e5", hex.EncodeToString(hashes[0]))
+		assert.Equal(t, "b343ea2b4520bf3378a24712b775332ba9090808", hex.EncodeToString(hashes[1]))
+		assert.Equal(t, "7e0a12e3db748013e270f0a4be6b8848f71d6ac7", hex.EncodeToString(hashes[2]))
+	})
+
+	t.Run("verifies the signature", func(t *testing.T) {
+		valid, err := signature.Verify(pbo)
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("signs the same bytes", func(t *testing.T) {
+		private, err := os.Open(filepath.Join("testdata", "WLZ_Fixture.biprivatekey"))
+		require.NoError(t, err)
+		defer private.Close()
+		privateKey, err := DecodeBIPrivateKey(private)
+		require.NoError(t, err)
+
+		signed, err := SignPBO(pbo, privateKey)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBISignature(&buf, signed))
+		assert.Equal(t, expected, buf.Bytes())
+	})
+}
+
+func TestSignPBO(t *testing.T) {
+	key, err := GenerateBIKey("WLZ")
+	require.NoError(t, err)
+	pbo := testPBO(t, map[string]string{"config.cpp": "class CfgPatches {};"}, `WLZ\Anniversary`)
+
+	signature, err := SignPBO(pbo, key)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), signature.Version)
+
+	hashes, err := biSignatureHashes(pbo, 3)
+	require.NoError(t, err)
+	for i, hash := range hashes {
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.Key.PublicKey, crypto.SHA1, hash, signature.Signatures[i]))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBISignature(&buf, signature))
+	data := buf.Bytes()
+
+	var public bytes.Buffer
+	require.NoError(t, EncodeBIKey(&public, key.Public()))
+	require.Len(t, data, public.Len()+4+128+4+4+128+4+128)
+	assert.Equal(t, public.Bytes(), data[:public.Len()])
+
+	data = data[public.Len():]
+	assert.Equal(t, uint32(128), binary.LittleEndian.Uint32(data))
+	assert.Equal(t, reverseBytes(slices.Clone(signature.Signatures[0])), data[4:132])
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(data[132:]))
+	assert.Equal(t, uint32(128), binary.LittleEndian.Uint32(data[136:]))
+	assert.Equal(t, reverseBytes(slices.Clone(signature.Signatures[1])), data[140:268])
+	assert.Equal(t, reverseBytes(slices.Clone(signature.Signatures[2])), data[272:])
+}
+
+func TestSignPBOFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, keygen("WLZ", dir, nil))
+	key, err := readBIPrivateKeyFile(filepath.Join(dir, "WLZ.biprivatekey"), passphraseSource{})
+	require.NoError(t, err)
+
+	pboPath := filepath.Join(dir, "WLZ_A.pbo")
+	require.NoError(t, pack(testFiles(t, map[string]string{"config.cpp": "class A {};"}), pboPath, `WLZ\A`, "", passphraseSource{}))
+
+	dst, err := signPBOFile(pboPath, key)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "WLZ_A.pbo.WLZ.bisign"), dst)
+	_, err = os.Stat(dst)
+	assert.NoError(t, err)
+}
+
+func TestBISignature_Verify(t *testing.T) {
+	key, err := GenerateBIKey("WLZ")
+	require.NoError(t, err)
+	pbo := testPBO(t, map[string]string{"config.cpp": "class CfgPatches {};", "init.sqf": "hint 1;"}, `WLZ\Anniversary`)
+
+	signature, err := SignPBO(pbo, key)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBISignature(&buf, signature))
+	decoded, err := DecodeBISignature(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, signature, decoded)
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		prefix   string
+		expected bool
+	}{
+		{
+			name:     "same contents",
+			files:    map[string]string{"config.cpp": "class CfgPatches {};", "init.sqf": "hint 1;"},
+			prefix:   `WLZ\Anniversary`,
+			expected: true,
+		},
+		{
+			name:   "changed script",
+			files:  map[string]string{"config.cpp": "class CfgPatches {};", "init.sqf": "hint 2;"},
+			prefix: `WLZ\Anniversary`,
+		},
+		{
+			name:   "renamed file",
+			files:  map[string]string{"config.cpp": "class CfgPatches {};", "main.sqf": "hint 1;"},
+			prefix: `WLZ\Anniversary`,
+		},
+		{
+			name:  "different prefix",
+			files: map[string]string{"config.cpp": "class CfgPatches {};", "init.sqf": "hint 1;"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valid, err := decoded.Verify(testPBO(t, test.files, test.prefix))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, valid)
+		})
+	}
+}
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ConfigPos is the location of a config entry, for error messages.
+type ConfigPos struct {
+	File string
+	Line int
+}
+
+func (p ConfigPos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// ConfigEntryKind is the kind of a config entry, numbered as in the
+// rapified format.
+type ConfigEntryKind int
+
+const (
+	ConfigClassEntry ConfigEntryKind = iota
+	ConfigValueEntry
+	ConfigArrayEntry
+	ConfigExternEntry
+	ConfigDeleteEntry
+	ConfigAppendEntry
+)
+
+// ConfigValueType is the type of a config value, numbered as in the
+// rapified format.
+type ConfigValueType int
+
+const (
+	ConfigString ConfigValueType = iota
+	ConfigFloat
+	ConfigInt
+	ConfigArray
+)
+
+// ConfigValue is a string, float, int or array value.
+type ConfigValue struct {
+	Type   ConfigValueType
+	String string
+	Float  float32
+	Int    int32
+	Array  []ConfigValue
+}
+
+// ConfigEntry is a class, value, array (name[] = or name[] +=), external
+// class declaration (class name;) or delete statement.
+type ConfigEntry struct {
+	Kind  ConfigEntryKind
+	Name  string
+	Class *ConfigClass
+	Value ConfigValue
+	Pos   ConfigPos
+}
+
+// ConfigClass is a class body. Base is the name of the class it inherits
+// from, if any.
+type ConfigClass struct {
+	Name    string
+	Base    string
+	Entries []ConfigEntry
+	Pos     ConfigPos
+}
+
+// ConfigEnum is a constant declared in an enum block.
+type ConfigEnum struct {
+	Name  string
+	Value int32
+}
+
+// Config is a parsed config file.
+type Config struct {
+	Root  *ConfigClass
+	Enums []ConfigEnum
+}
+
+// ConfigError is a parse error at a position in a config file.
+type ConfigError struct {
+	Pos ConfigPos
+	Err string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+}
+
+// ParseConfig parses a config (config.cpp, .rvmat and the like). Values
+// which are not quoted are stored as ints or floats where they parse as
+// one, enum constants are replaced with their value, and anything else is
+// stored as a string.
+func ParseConfig(file string, data []byte) (*Config, error) {
+	p := &configParser{data: data, pos: ConfigPos{File: file, Line: 1}, enums: map[string]int32{}}
+	config := &Config{Root: &ConfigClass{Pos: p.pos}}
+	err := p.parseBody(config, config.Root, true)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+type configParser struct {
+	data  []byte
+	i     int
+	pos   ConfigPos
+	enums map[string]int32
+}
+
+func (p *configParser) errorf(format string, args ...any) error {
+	return &ConfigError{Pos: p.pos, Err: fmt.Sprintf(format, args...)}
+}
+
+func (p *configParser) peek() byte {
+	if p.i >= len(p.data) {
+		return 0
+	}
+	return p.data[p.i]
+}
+
+func (p *configParser) next() byte {
+	c := p.peek()
+	if c == '\n' {
+		p.pos.Line++
+	}
+	p.i++
+	return c
+}
+
+// skipSpace skips whitespace and comments.
+func (p *configParser) skipSpace() error {
+	for p.i < len(p.data) {
+		switch {
+		case p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r' || p.peek() == '\n':
+			p.next()
+		case strings.HasPrefix(string(p.data[p.i:min(p.i+2, len(p.data))]), "//"):
+			for p.i < len(p.data) && p.peek() != '\n' {
+				p.next()
+			}
+		case strings.HasPrefix(string(p.data[p.i:min(p.i+2, len(p.data))]), "/*"):
+			start := p.pos
+			p.i += 2
+			for p.i < len(p.data) && !strings.HasPrefix(string(p.data[p.i:min(p.i+2, len(p.data))]), "*/") {
+				p.next()
+			}
+			if p.i >= len(p.data) {
+				return &ConfigError{Pos: start, Err: "unterminated comment"}
+			}
+			p.i += 2
+		case p.peek() == '#' && p.atLineStart():
+			if err := p.lineMarker(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// lineMarker parses a #line marker left by the preprocessor, which sets the
+// position of the next line. Any other directive is an error, as the file
+// has not been preprocessed.
+func (p *configParser) lineMarker() error {
+	end := bytes.IndexByte(p.data[p.i:], '\n')
+	if end < 0 {
+		end = len(p.data) - p.i
+	}
+	directive := string(p.data[p.i : p.i+end])
+	match := lineMarkerPattern.FindStringSubmatch(directive)
+	if match == nil {
+		return p.errorf("unexpected preprocessor directive %s", strings.Fields(directive)[0])
+	}
+	line, err := strconv.Atoi(match[1])
+	if err != nil {
+		return p.errorf("invalid line marker %s", directive)
+	}
+	p.i += end + 1
+	p.pos = ConfigPos{File: match[2], Line: line}
+	return nil
+}
+
+var lineMarkerPattern = regexp.MustCompile(`^#line (\d+) "([^"]*)"\s*$`)
+
+func (p *configParser) atLineStart() bool {
+	for j := p.i - 1; j >= 0; j-- {
+		switch p.data[j] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (p *configParser) expect(c byte, context string) error {
+	if err := p.skipSpace(); err != nil {
+		return err
+	}
+	if p.peek() != c {
+		return p.errorf("expected '%c' %s, found %s", c, context, p.describe())
+	}
+	p.next()
+	return nil
+}
+
+func (p *configParser) describe() string {
+	if p.i >= len(p.data) {
+		return "end of file"
+	}
+	return strconv.Quote(string(p.data[p.i]))
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *configParser) ident(what string) (string, error) {
+	if err := p.skipSpace(); err != nil {
+		return "", err
+	}
+	start := p.i
+	for p.i < len(p.data) && isIdentByte(p.peek()) {
+		p.next()
+	}
+	if start == p.i {
+		return "", p.errorf("expected %s, found %s", what, p.describe())
+	}
+	return string(p.data[start:p.i]), nil
+}
+
+// parseBody parses entries until the closing brace of class, or the end of
+// the file for the root class.
+func (p *configParser) parseBody(config *Config, class *ConfigClass, root bool) error {
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if p.i >= len(p.data) {
+			if root {
+				return nil
+			}
+			return &ConfigError{Pos: class.Pos, Err: fmt.Sprintf("class %s is missing its closing '}'", class.Name)}
+		}
+		if p.peek() == '}' {
+			if root {
+				return p.errorf("unexpected '}'")
+			}
+			p.next()
+			return p.expect(';', fmt.Sprintf("after class %s", class.Name))
+		}
+
+		pos := p.pos
+		name, err := p.ident("a class, value or array")
+		if err != nil {
+			return err
+		}
+
+		switch name {
+		case "class":
+			entry, err := p.parseClass(config, pos)
+			if err != nil {
+				return err
+			}
+			class.Entries = append(class.Entries, entry)
+		case "delete":
+			name, err := p.ident("a class name after delete")
+			if err != nil {
+				return err
+			}
+			class.Entries = append(class.Entries, ConfigEntry{Kind: ConfigDeleteEntry, Name: name, Pos: pos})
+			if err := p.expect(';', "after delete "+name); err != nil {
+				return err
+			}
+		case "enum":
+			if err := p.parseEnum(config); err != nil {
+				return err
+			}
+		default:
+			entry, err := p.parseValue(name, pos)
+			if err != nil {
+				return err
+			}
+			class.Entries = append(class.Entries, entry)
+		}
+	}
+}
+
+func (p *configParser) parseClass(config *Config, pos ConfigPos) (ConfigEntry, error) {
+	name, err := p.ident("a class name")
+	if err != nil {
+		return ConfigEntry{}, err
+	}
+	if err := p.skipSpace(); err != nil {
+		return ConfigEntry{}, err
+	}
+	if p.peek() == ';' {
+		p.next()
+		return ConfigEntry{Kind: ConfigExternEntry, Name: name, Pos: pos}, nil
+	}
+
+	class := &ConfigClass{Name: name, Pos: pos}
+	if p.peek() == ':' {
+		p.next()
+		class.Base, err = p.ident("a base class name after ':'")
+		if err != nil {
+			return ConfigEntry{}, err
+		}
+	}
+	if err := p.expect('{', "after class "+name); err != nil {
+		return ConfigEntry{}, err
+	}
+	if err := p.parseBody(config, class, false); err != nil {
+		return ConfigEntry{}, err
+	}
+	return ConfigEntry{Kind: ConfigClassEntry, Name: name, Class: class, Pos: pos}, nil
+}
+
+// parseEnum parses enum { A, B = 5, C }; where unassigned constants count
+// up from the previous one.
+func (p *configParser) parseEnum(config *Config) error {
+	if err := p.expect('{', "after enum"); err != nil {
+		return err
+	}
+	next := int32(0)
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if p.peek() == '}' {
+			p.next()
+			return p.expect(';', "after enum")
+		}
+		name, err := p.ident("an enum constant")
+		if err != nil {
+			return err
+		}
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if p.peek() == '=' {
+			p.next()
+			raw, err := p.raw(",}")
+			if err != nil {
+				return err
+			}
+			value, ok := p.number(raw)
+			if !ok || value.Type != ConfigInt {
+				return p.errorf("enum constant %s must be an integer, found %q", name, raw)
+			}
+			next = value.Int
+		}
+		config.Enums = append(config.Enums, ConfigEnum{Name: name, Value: next})
+		p.enums[name] = next
+		next++
+
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if p.peek() == ',' {
+			p.next()
+		} else if p.peek() != '}' {
+			return p.errorf("expected ',' or '}' in enum, found %s", p.describe())
+		}
+	}
+}
+
+func (p *configParser) parseValue(name string, pos ConfigPos) (ConfigEntry, error) {
+	if err := p.skipSpace(); err != nil {
+		return ConfigEntry{}, err
+	}
+	if p.peek() == '[' {
+		p.next()
+		if err := p.expect(']', "after "+name+"["); err != nil {
+			return ConfigEntry{}, err
+		}
+		kind := ConfigArrayEntry
+		if err := p.skipSpace(); err != nil {
+			return ConfigEntry{}, err
+		}
+		if p.peek() == '+' {
+			p.next()
+			kind = ConfigAppendEntry
+		}
+		if err := p.expect('=', "after "+name+"[]"); err != nil {
+			return ConfigEntry{}, err
+		}
+		if err := p.expect('{', "to start array "+name); err != nil {
+			return ConfigEntry{}, err
+		}
+		array, err := p.parseArray()
+		if err != nil {
+			return ConfigEntry{}, err
+		}
+		if err := p.expect(';', "after array "+name); err != nil {
+			return ConfigEntry{}, err
+		}
+		return ConfigEntry{Kind: kind, Name: name, Value: array, Pos: pos}, nil
+	}
+
+	if err := p.expect('=', "after "+name); err != nil {
+		return ConfigEntry{}, err
+	}
+	value, err := p.parseScalar(";")
+	if err != nil {
+		return ConfigEntry{}, err
+	}
+	if value.Type == ConfigArray {
+		return ConfigEntry{}, &ConfigError{Pos: pos, Err: fmt.Sprintf("array %s must be declared as %s[]", name, name)}
+	}
+	if err := p.expect(';', "after value "+name); err != nil {
+		return ConfigEntry{}, err
+	}
+	return ConfigEntry{Kind: ConfigValueEntry, Name: name, Value: value, Pos: pos}, nil
+}
+
+// parseArray parses array elements after the opening brace, up to and
+// including the closing brace. A trailing comma is allowed.
+func (p *configParser) parseArray() (ConfigValue, error) {
+	array := ConfigValue{Type: ConfigArray, Array: []ConfigValue{}}
+	for {
+		if err := p.skipSpace(); err != nil {
+			return array, err
+		}
+		if p.peek() == '}' {
+			p.next()
+			return array, nil
+		}
+		value, err := p.parseScalar(",}")
+		if err != nil {
+			return array, err
+		}
+		array.Array = append(array.Array, value)
+
+		if err := p.skipSpace(); err != nil {
+			return array, err
+		}
+		if p.peek() == ',' {
+			p.next()
+		} else if p.peek() != '}' {
+			return array, p.errorf("expected ',' or '}' in array, found %s", p.describe())
+		}
+	}
+}
+
+// parseScalar parses a quoted string, nested array or unquoted value ending
+// at one of the terminators.
+func (p *configParser) parseScalar(terminators string) (ConfigValue, error) {
+	if err := p.skipSpace(); err != nil {
+		return ConfigValue{}, err
+	}
+	switch p.peek() {
+	case '{':
+		p.next()
+		return p.parseArray()
+	case '"', '\'':
+		s, err := p.quoted()
+		return ConfigValue{Type: ConfigString, String: s}, err
+	}
+
+	raw, err := p.raw(terminators)
+	if err != nil {
+		return ConfigValue{}, err
+	}
+	if raw == "" {
+		return ConfigValue{}, p.errorf("expected a value, found %s", p.describe())
+	}
+	if value, ok := p.enums[raw]; ok {
+		return ConfigValue{Type: ConfigInt, Int: value}, nil
+	}
+	if value, ok := p.number(raw); ok {
+		return value, nil
+	}
+	return ConfigValue{Type: ConfigString, String: raw}, nil
+}
+
+// quoted parses a string in double or single quotes, where a doubled quote
+// is a literal quote.
+func (p *configParser) quoted() (string, error) {
+	start := p.pos
+	quote := p.next()
+	var s strings.Builder
+	for {
+		if p.i >= len(p.data) || p.peek() == '\n' {
+			return "", &ConfigError{Pos: start, Err: "unterminated string"}
+		}
+		c := p.next()
+		if c == quote {
+			if p.peek() != quote {
+				return s.String(), nil
+			}
+			p.next()
+		}
+		s.WriteByte(c)
+	}
+}
+
+// raw returns the trimmed text up to one of the terminators. Values end at
+// the end of the line, array elements may be followed by a line break.
+func (p *configParser) raw(terminators string) (string, error) {
+	start := p.i
+	for p.i < len(p.data) && !strings.ContainsRune(terminators, rune(p.peek())) {
+		if p.peek() == '\n' {
+			if !strings.Contains(terminators, ";") {
+				break
+			}
+			return "", p.errorf("expected %s, found end of line", quoteTerminators(terminators))
+		}
+		p.next()
+	}
+	if p.i >= len(p.data) {
+		return "", p.errorf("expected %s, found end of file", quoteTerminators(terminators))
+	}
+	return strings.TrimSpace(string(p.data[start:p.i])), nil
+}
+
+func quoteTerminators(terminators string) string {
+	quoted := []string{}
+	for _, c := range terminators {
+		quoted = append(quoted, "'"+string(c)+"'")
+	}
+	return strings.Join(quoted, " or ")
+}
+
+// number parses raw as an int (decimal or 0x hexadecimal) or a float.
+func (p *configParser) number(raw string) (ConfigValue, bool) {
+	digits, negative := strings.CutPrefix(raw, "-")
+	if hex, ok := strings.CutPrefix(strings.ToLower(digits), "0x"); ok {
+		if i, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			if negative {
+				return ConfigValue{Type: ConfigInt, Int: -int32(i)}, true
+			}
+			return ConfigValue{Type: ConfigInt, Int: int32(i)}, true
+		}
+		return ConfigValue{}, false
+	}
+	if i, err := strconv.ParseInt(raw, 10, 32); err == nil {
+		return ConfigValue{Type: ConfigInt, Int: int32(i)}, true
+	}
+	if !floatPattern.MatchString(raw) {
+		return ConfigValue{}, false
+	}
+	if f, err := strconv.ParseFloat(raw, 32); err == nil {
+		return ConfigValue{Type: ConfigFloat, Float: float32(f)}, true
+	}
+	return ConfigValue{}, false
+}
+
+var floatPattern = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// WriteConfig writes config as text, with tab indentation, one entry per
+// line and braces on their own lines. Strings are always quoted.
+func WriteConfig(w io.Writer, config *Config) error {
+	var buf bytes.Buffer
+	if len(config.Enums) > 0 {
+		buf.WriteString("enum\n{\n")
+		for i, enum := range config.Enums {
+			fmt.Fprintf(&buf, "\t%s = %d", enum.Name, enum.Value)
+			if i < len(config.Enums)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("};\n")
+	}
+	writeConfigEntries(&buf, config.Root.Entries, 0)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeConfigEntries(buf *bytes.Buffer, entries []ConfigEntry, depth int) {
+	indent := strings.Repeat("\t", depth)
+	for _, entry := range entries {
+		buf.WriteString(indent)
+		switch entry.Kind {
+		case ConfigClassEntry:
+			buf.WriteString("class " + entry.Name)
+			if entry.Class.Base != "" {
+				buf.WriteString(": " + entry.Class.Base)
+			}
+			if len(entry.Class.Entries) == 0 {
+				buf.WriteString(" {};\n")
+				continue
+			}
+			buf.WriteString("\n" + indent + "{\n")
+			writeConfigEntries(buf, entry.Class.Entries, depth+1)
+			buf.WriteString(indent + "};\n")
+		case ConfigValueEntry:
+			buf.WriteString(entry.Name + " = " + formatConfigValue(entry.Value) + ";\n")
+		case ConfigArrayEntry:
+			buf.WriteString(entry.Name + "[] = " + formatConfigValue(entry.Value) + ";\n")
+		case ConfigAppendEntry:
+			buf.WriteString(entry.Name + "[] += " + formatConfigValue(entry.Value) + ";\n")
+		case ConfigExternEntry:
+			buf.WriteString("class " + entry.Name + ";\n")
+		case ConfigDeleteEntry:
+			buf.WriteString("delete " + entry.Name + ";\n")
+		}
+	}
+}
+
+// formatConfigValue formats a value so that it parses back to the same type.
+func formatConfigValue(value ConfigValue) string {
+	switch value.Type {
+	case ConfigFloat:
+		s := strconv.FormatFloat(float64(value.Float), 'g', -1, 32)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case ConfigInt:
+		return strconv.Itoa(int(value.Int))
+	case ConfigArray:
+		values := []string{}
+		for _, element := range value.Array {
+			values = append(values, formatConfigValue(element))
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	default:
+		return `"` + strings.ReplaceAll(value.String, `"`, `""`) + `"`
+	}
+}
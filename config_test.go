@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("parses classes, values and arrays", func(t *testing.T) {
+		config, err := ParseConfig("config.cpp", []byte(`
+// comment
+class CfgPatches
+{
+	class WILDLANDZ_Anniversary
+	{
+		units[] = {"WLZ_Cupcake", 'WLZ_Box'};
+		weapons[] = {};
+		requiredVersion = 0.1;
+		requiredAddons[] = {"DZ_Data",};
+	};
+};
+class CfgVehicles
+{
+	class Inventory_Base;
+	class WLZ_Cupcake: Inventory_Base /* inherits */
+	{
+		scope = 2;
+		displayName = "Cupcake ""deluxe""";
+		model = \WILDLANDZ\Anniversary\gear\food\data\cupcake.p3d;
+		weight = -0x10;
+		hiddenSelectionsTextures[] += {{1, 2.5e1}, -3};
+		delete Rotten;
+	};
+};
+`))
+		require.NoError(t, err)
+
+		patches := config.Root.Entries[0]
+		assert.Equal(t, ConfigClassEntry, patches.Kind)
+		assert.Equal(t, "CfgPatches", patches.Name)
+		assert.Equal(t, ConfigPos{File: "config.cpp", Line: 3}, patches.Pos)
+
+		addon := patches.Class.Entries[0].Class
+		assert.Equal(t, []ConfigEntry{
+			{Kind: ConfigArrayEntry, Name: "units", Value: ConfigValue{Type: ConfigArray, Array: []ConfigValue{
+				{Type: ConfigString, String: "WLZ_Cupcake"},
+				{Type: ConfigString, String: "WLZ_Box"},
+			}}, Pos: ConfigPos{File: "config.cpp", Line: 7}},
+			{Kind: ConfigArrayEntry, Name: "weapons", Value: ConfigValue{Type: ConfigArray, Array: []ConfigValue{}}, Pos: ConfigPos{File: "config.cpp", Line: 8}},
+			{Kind: ConfigValueEntry, Name: "requiredVersion", Value: ConfigValue{Type: ConfigFloat, Float: 0.1}, Pos: ConfigPos{File: "config.cpp", Line: 9}},
+			{Kind: ConfigArrayEntry, Name: "requiredAddons", Value: ConfigValue{Type: ConfigArray, Array: []ConfigValue{
+				{Type: ConfigString, String: "DZ_Data"},
+			}}, Pos: ConfigPos{File: "config.cpp", Line: 10}},
+		}, addon.Entries)
+
+		vehicles := config.Root.Entries[1].Class
+		assert.Equal(t, ConfigExternEntry, vehicles.Entries[0].Kind)
+		assert.Equal(t, "Inventory_Base", vehicles.Entries[0].Name)
+
+		cupcake := vehicles.Entries[1].Class
+		assert.Equal(t, "WLZ_Cupcake", cupcake.Name)
+		assert.Equal(t, "Inventory_Base", cupcake.Base)
+		assert.Equal(t, ConfigValue{Type: ConfigInt, Int: 2}, cupcake.Entries[0].Value)
+		assert.Equal(t, ConfigValue{Type: ConfigString, String: `Cupcake "deluxe"`}, cupcake.Entries[1].Value)
+		assert.Equal(t, ConfigValue{Type: ConfigString, String: `\WILDLANDZ\Anniversary\gear\food\data\cupcake.p3d`}, cupcake.Entries[2].Value)
+		assert.Equal(t, ConfigValue{Type: ConfigInt, Int: -16}, cupcake.Entries[3].Value)
+		assert.Equal(t, ConfigAppendEntry, cupcake.Entries[4].Kind)
+		assert.Equal(t, ConfigValue{Type: ConfigArray, Array: []ConfigValue{
+			{Type: ConfigArray, Array: []ConfigValue{{Type: ConfigInt, Int: 1}, {Type: ConfigFloat, Float: 25}}},
+			{Type: ConfigInt, Int: -3},
+		}}, cupcake.Entries[4].Value)
+		assert.Equal(t, ConfigEntry{Kind: ConfigDeleteEntry, Name: "Rotten", Pos: ConfigPos{File: "config.cpp", Line: 23}}, cupcake.Entries[5])
+	})
+
+	t.Run("parses enums", func(t *testing.T) {
+		config, err := ParseConfig("config.cpp", []byte(`
+enum { DestructNo, DestructBuilding = 5, DestructEngine };
+class A { destrType = DestructEngine; };
+`))
+		require.NoError(t, err)
+		assert.Equal(t, []ConfigEnum{{"DestructNo", 0}, {"DestructBuilding", 5}, {"DestructEngine", 6}}, config.Enums)
+		assert.Equal(t, ConfigValue{Type: ConfigInt, Int: 6}, config.Root.Entries[0].Class.Entries[0].Value)
+	})
+
+	// unquoted array elements end at a line break, as derapify writes the
+	// last element of an array on a line of its own
+	arrayTests := []struct {
+		name     string
+		config   string
+		expected []ConfigValue
+	}{
+		{
+			"last element before the closing brace",
+			"values[] =\n{\n\t1,\n\tabc\n};\n",
+			[]ConfigValue{{Type: ConfigInt, Int: 1}, {Type: ConfigString, String: "abc"}},
+		},
+		{
+			"comma on the next line",
+			"values[] = {abc\n, def\n};\n",
+			[]ConfigValue{{Type: ConfigString, String: "abc"}, {Type: ConfigString, String: "def"}},
+		},
+		{
+			"nested arrays",
+			"values[] = {{1.5\n}, {abc\n}\n};\n",
+			[]ConfigValue{
+				{Type: ConfigArray, Array: []ConfigValue{{Type: ConfigFloat, Float: 1.5}}},
+				{Type: ConfigArray, Array: []ConfigValue{{Type: ConfigString, String: "abc"}}},
+			},
+		},
+	}
+	for _, test := range arrayTests {
+		t.Run("parses arrays spanning lines with the "+test.name, func(t *testing.T) {
+			config, err := ParseConfig("config.cpp", []byte(test.config))
+			require.NoError(t, err)
+			assert.Equal(t, ConfigValue{Type: ConfigArray, Array: test.expected}, config.Root.Entries[0].Value)
+		})
+	}
+
+	errorTests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{"missing semicolon after value", "class A\n{\n\tscope = 2\n};\n", `config.cpp:3: expected ';', found end of line`},
+		{"missing semicolon after class", "class A\n{\n}\nclass B {};\n", `config.cpp:4: expected ';' after class A, found "c"`},
+		{"unclosed class", "class A\n{\n\tscope = 2;\n", "config.cpp:1: class A is missing its closing '}'"},
+		{"array without brackets", "class A\n{\n\tunits = {1};\n};\n", "config.cpp:3: array units must be declared as units[]"},
+		{"unterminated string", "class A\n{\n\tname = \"cupcake;\n};\n", "config.cpp:3: unterminated string"},
+		{"unterminated comment", "/* class A\n{};\n", "config.cpp:1: unterminated comment"},
+		{"stray brace", "class A {};\n};\n", "config.cpp:2: unexpected '}'"},
+		{"missing value", "class A\n{\n\tscope = ;\n};\n", `config.cpp:3: expected a value, found ";"`},
+		{"array elements on separate lines without a comma", "values[] = {abc\ndef};\n", `config.cpp:2: expected ',' or '}' in array, found "d"`},
+		{"array element at the end of the file", "values[] = {abc", `config.cpp:1: expected ',' or '}', found end of file`},
+	}
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseConfig("config.cpp", []byte(test.config))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		})
+	}
+}
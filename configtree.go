@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newConfigCommand() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "config",
+		ShortUsage: "mod-build config <command> ...",
+		ShortHelp:  "Inspect the configs of an addon",
+		UsageFunc:  usage,
+		FlagSet:    flag.NewFlagSet("mod-build config", flag.ExitOnError),
+		Subcommands: []*ffcli.Command{
+			newConfigShowCommand(),
+		},
+		Exec: func(ctx context.Context, args []string) error {
+			fmt.Fprintln(os.Stderr, "error: command is required")
+			fmt.Fprintln(os.Stderr, "")
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newConfigShowCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build config show", flag.ExitOnError)
+	var vanilla configFiles
+	flags.Var(&vanilla, "vanilla", "Config to load before the addon's configs, such as a dump of the vanilla configs as text or config.bin, may be repeated")
+
+	return &ffcli.Command{
+		Name:       "show",
+		ShortUsage: "mod-build config show [options] <source-directory> <ClassPath>",
+		ShortHelp:  "Print the effective properties of a class",
+		LongHelp: "Print the effective properties of a class, such as CfgVehicles/WLZ_Cupcake,\n" +
+			"after loading every config.cpp of the addon and resolving inheritance. Each\n" +
+			"property is printed with the class and file it came from.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				fmt.Fprintln(os.Stderr, "error: source directory and class path are required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return showConfigClass(os.Stdout, args[0], args[1], vanilla)
+		},
+	}
+}
+
+// configFiles is a list of config files given by a repeated flag.
+type configFiles []string
+
+func (f *configFiles) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ", ")
+}
+
+func (f *configFiles) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func showConfigClass(w io.Writer, sourceDir, classPath string, vanilla []string) error {
+	tree := NewConfigTree()
+	for _, path := range vanilla {
+		config, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		tree.Add(config)
+	}
+
+	source := NewSource(sourceDir)
+	err := source.EnsureValid()
+	if err != nil {
+		return err
+	}
+	prefix, err := source.Prefix()
+	if err != nil {
+		return err
+	}
+	task, err := source.Prepare()
+	if err != nil {
+		return err
+	}
+	preprocessor := NewPreprocessor(sourceDir, prefix)
+	var configs []*Config
+	for _, path := range task.Copy {
+		if !isRapifiable(path) {
+			continue
+		}
+		config, err := loadConfig(preprocessor, path)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, config)
+	}
+	for _, config := range sortByRequiredAddons(configs) {
+		tree.Add(config)
+	}
+
+	class, err := tree.Find(classPath)
+	if err != nil {
+		return err
+	}
+	return WriteEffectiveClass(w, class)
+}
+
+// readConfigFile reads a config which is either rapified or text. Text is
+// parsed without preprocessing, as dumps are already preprocessed.
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(rapSignature)) {
+		config, err := Derapify(data)
+		if err != nil {
+			return nil, fmt.Errorf("error derapifying %q: %w", path, err)
+		}
+		setConfigFile(config.Root, path)
+		return config, nil
+	}
+	return ParseConfig(path, data)
+}
+
+// sortByRequiredAddons returns configs in the order the game loads them:
+// each after the configs declaring the addons in its requiredAddons, and
+// otherwise in the order given. Addons which require each other are left in
+// the order given.
+func sortByRequiredAddons(configs []*Config) []*Config {
+	// the configs declaring each addon, by lower case name
+	declaring := map[string][]int{}
+	for i, config := range configs {
+		for _, patch := range patchesClasses(config) {
+			name := strings.ToLower(patch.Name)
+			declaring[name] = append(declaring[name], i)
+		}
+	}
+
+	sorted := make([]*Config, 0, len(configs))
+	visited := make([]bool, len(configs))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, patch := range patchesClasses(configs[i]) {
+			for _, entry := range findConfigArrays(patch, "requiredAddons") {
+				for _, name := range configStrings(entry.Value) {
+					for _, j := range declaring[strings.ToLower(name)] {
+						visit(j)
+					}
+				}
+			}
+		}
+		sorted = append(sorted, configs[i])
+	}
+	for i := range configs {
+		visit(i)
+	}
+	return sorted
+}
+
+// setConfigFile sets the file of the positions in class, for rapified
+// configs which have none.
+func setConfigFile(class *ConfigClass, file string) {
+	class.Pos.File = file
+	for i := range class.Entries {
+		class.Entries[i].Pos.File = file
+		if class.Entries[i].Class != nil {
+			setConfigFile(class.Entries[i].Class, file)
+		}
+	}
+}
+
+// ConfigTree is a set of configs loaded in order, as the game loads them: a
+// class which is defined again is extended, and a value which is defined
+// again is replaced.
+type ConfigTree struct {
+	Root *ConfigNode
+}
+
+// ConfigNode is a class of a ConfigTree. Classes which are only declared
+// (class Name;) are not Defined.
+type ConfigNode struct {
+	Name    string
+	Base    string
+	Parent  *ConfigNode
+	Pos     ConfigPos
+	Defined bool
+	Classes []*ConfigNode
+	Values  []ConfigEntry
+}
+
+// ConfigProperty is an effective value of a class. Sources lists the
+// classes it came from in inheritance order, base classes first, more than
+// one if it was appended to with +=.
+type ConfigProperty struct {
+	Name    string
+	Value   ConfigValue
+	Sources []ConfigSource
+}
+
+// ConfigSource is the class and position a value was defined at.
+type ConfigSource struct {
+	Class *ConfigNode
+	Pos   ConfigPos
+}
+
+func (s ConfigSource) String() string {
+	pos := s.Pos.String()
+	if s.Pos.Line == 0 {
+		pos = s.Pos.File
+	}
+	return fmt.Sprintf("%s (%s)", s.Class.Name, pos)
+}
+
+// maxInheritanceDepth limits how far inheritance is followed, to stop on
+// classes which (indirectly) inherit from themselves.
+const maxInheritanceDepth = 64
+
+func NewConfigTree() *ConfigTree {
+	return &ConfigTree{Root: &ConfigNode{Defined: true}}
+}
+
+// Add merges config into the tree.
+func (t *ConfigTree) Add(config *Config) {
+	t.Root.merge(config.Root)
+}
+
+// Find returns the class at path, with the names of the classes separated
+// by / or >>, such as CfgVehicles/WLZ_Cupcake. Classes inherited from a base
+// class are found too.
+func (t *ConfigTree) Find(path string) (*ConfigNode, error) {
+	node := t.Root
+	for _, name := range classPathSeparator.Split(strings.Trim(path, "/ "), -1) {
+		member, err := node.member(name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			if node == t.Root {
+				return nil, fmt.Errorf("class %s not found", name)
+			}
+			return nil, fmt.Errorf("class %s not found in %s", name, node.Path())
+		}
+		node = member
+	}
+	if !node.Defined {
+		return nil, fmt.Errorf("class %s is declared but not defined (load the config defining it with -vanilla)", node.Path())
+	}
+	return node, nil
+}
+
+var classPathSeparator = regexp.MustCompile(`\s*(/|>>)\s*`)
+
+// Path returns the names of the classes containing n and n, separated by /.
+func (n *ConfigNode) Path() string {
+	if n.Parent == nil || n.Parent.Parent == nil {
+		return n.Name
+	}
+	return n.Parent.Path() + "/" + n.Name
+}
+
+func (n *ConfigNode) merge(class *ConfigClass) {
+	if class.Base != "" {
+		n.Base = class.Base
+	}
+	for _, entry := range class.Entries {
+		switch entry.Kind {
+		case ConfigClassEntry, ConfigExternEntry:
+			child := n.class(entry.Name)
+			if child == nil {
+				child = &ConfigNode{Name: entry.Name, Parent: n, Pos: entry.Pos}
+				n.Classes = append(n.Classes, child)
+			}
+			if entry.Kind == ConfigClassEntry {
+				if !child.Defined {
+					child.Pos = entry.Pos
+					child.Defined = true
+				}
+				child.merge(entry.Class)
+			}
+		case ConfigDeleteEntry:
+			for i, child := range n.Classes {
+				if strings.EqualFold(child.Name, entry.Name) {
+					n.Classes = append(n.Classes[:i:i], n.Classes[i+1:]...)
+					break
+				}
+			}
+		default:
+			n.setValue(entry)
+		}
+	}
+}
+
+// setValue adds or replaces a value of n. Appends are kept as values of
+// their own after the value they extend, so the appended elements keep their
+// position, and are joined with it by Properties.
+func (n *ConfigNode) setValue(entry ConfigEntry) {
+	for i, value := range n.Values {
+		if !strings.EqualFold(value.Name, entry.Name) {
+			continue
+		}
+		if entry.Kind == ConfigAppendEntry && value.Value.Type == ConfigArray {
+			n.Values = append(n.Values, entry)
+			return
+		}
+		n.Values[i] = entry
+		// the appends to the replaced value are replaced too
+		n.Values = append(n.Values[:i+1], slices.DeleteFunc(n.Values[i+1:], func(value ConfigEntry) bool {
+			return strings.EqualFold(value.Name, entry.Name)
+		})...)
+		return
+	}
+	n.Values = append(n.Values, entry)
+}
+
+// class returns the class called name defined or declared directly in n.
+func (n *ConfigNode) class(name string) *ConfigNode {
+	for _, child := range n.Classes {
+		if strings.EqualFold(child.Name, name) {
+			return child
+		}
+	}
+	return nil
+}
+
+// BaseClass returns the class n inherits from, or nil if it has no base.
+// The base class is looked up in the classes containing n, and the classes
+// they inherit.
+func (n *ConfigNode) BaseClass() (*ConfigNode, error) {
+	return n.baseClass(0)
+}
+
+func (n *ConfigNode) baseClass(depth int) (*ConfigNode, error) {
+	if n.Base == "" {
+		return nil, nil
+	}
+	if depth > maxInheritanceDepth {
+		return nil, fmt.Errorf("class %s inherits from itself", n.Path())
+	}
+	for scope := n.Parent; scope != nil; scope = scope.Parent {
+		base, err := scope.member(n.Base, n, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if base != nil {
+			return base, nil
+		}
+	}
+	return nil, fmt.Errorf("base class %s of %s is not defined", n.Base, n.Path())
+}
+
+// member returns the class called name defined in n, or inherited by n,
+// other than exclude.
+func (n *ConfigNode) member(name string, exclude *ConfigNode, depth int) (*ConfigNode, error) {
+	for _, child := range n.Classes {
+		if child != exclude && strings.EqualFold(child.Name, name) {
+			return child, nil
+		}
+	}
+	base, err := n.baseClass(depth)
+	if base == nil || err != nil {
+		return nil, err
+	}
+	return base.member(name, exclude, depth+1)
+}
+
+// Inheritance returns n followed by the classes it inherits from, nearest
+// first. It ends with a class which is declared but not defined if the
+// config defining it was not loaded.
+func (n *ConfigNode) Inheritance() ([]*ConfigNode, error) {
+	chain := []*ConfigNode{n}
+	for class := n; ; {
+		base, err := class.BaseClass()
+		if err != nil {
+			return nil, err
+		}
+		if base == nil {
+			return chain, nil
+		}
+		if len(chain) > maxInheritanceDepth {
+			return nil, fmt.Errorf("class %s inherits from itself", n.Path())
+		}
+		chain = append(chain, base)
+		class = base
+	}
+}
+
+// Properties returns the effective values of n, including the values it
+// inherits, in the order they were first defined.
+func (n *ConfigNode) Properties() ([]ConfigProperty, error) {
+	chain, err := n.Inheritance()
+	if err != nil {
+		return nil, err
+	}
+
+	var properties []ConfigProperty
+	for i := len(chain) - 1; i >= 0; i-- {
+		class := chain[i]
+		for _, entry := range class.Values {
+			source := ConfigSource{Class: class, Pos: entry.Pos}
+			index := -1
+			for j, property := range properties {
+				if strings.EqualFold(property.Name, entry.Name) {
+					index = j
+				}
+			}
+			switch {
+			case index < 0:
+				properties = append(properties, ConfigProperty{Name: entry.Name, Value: entry.Value, Sources: []ConfigSource{source}})
+			case entry.Kind == ConfigAppendEntry && properties[index].Value.Type == ConfigArray:
+				property := &properties[index]
+				property.Value.Array = append(append([]ConfigValue{}, property.Value.Array...), entry.Value.Array...)
+				property.Sources = append(property.Sources, source)
+			default:
+				properties[index] = ConfigProperty{Name: entry.Name, Value: entry.Value, Sources: []ConfigSource{source}}
+			}
+		}
+	}
+	return properties, nil
+}
+
+// Members returns the classes defined in n and the classes it inherits
+// which n does not define itself.
+func (n *ConfigNode) Members() ([]*ConfigNode, error) {
+	chain, err := n.Inheritance()
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*ConfigNode
+	seen := map[string]bool{}
+	for _, class := range chain {
+		for _, child := range class.Classes {
+			if !seen[strings.ToLower(child.Name)] {
+				seen[strings.ToLower(child.Name)] = true
+				members = append(members, child)
+			}
+		}
+	}
+	return members, nil
+}
+
+// WriteEffectiveClass writes the effective properties and classes of n,
+// commented with where each came from.
+func WriteEffectiveClass(w io.Writer, n *ConfigNode) error {
+	chain, err := n.Inheritance()
+	if err != nil {
+		return err
+	}
+	properties, err := n.Properties()
+	if err != nil {
+		return err
+	}
+	members, err := n.Members()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	paths := []string{}
+	for _, class := range chain {
+		if !class.Defined {
+			paths = append(paths, class.Path()+" (not loaded)")
+			continue
+		}
+		paths = append(paths, class.Path())
+	}
+	fmt.Fprintf(&buf, "// %s\n", strings.Join(paths, " -> "))
+	buf.WriteString("class " + n.Name)
+	if n.Base != "" {
+		buf.WriteString(": " + n.Base)
+	}
+	buf.WriteString("\n{\n")
+	for _, property := range properties {
+		sources := []string{}
+		for _, source := range property.Sources {
+			sources = append(sources, source.String())
+		}
+		name := property.Name
+		if property.Value.Type == ConfigArray {
+			name += "[]"
+		}
+		fmt.Fprintf(&buf, "\t%s = %s; // %s\n", name, formatConfigValue(property.Value), strings.Join(sources, " += "))
+	}
+	for _, member := range members {
+		declaration := "class " + member.Name
+		if member.Base != "" {
+			declaration += ": " + member.Base
+		}
+		if member.Defined {
+			declaration += " {...}"
+		}
+		source := ConfigSource{Class: member.Parent, Pos: member.Pos}
+		fmt.Fprintf(&buf, "\t%s; // %s\n", declaration, source)
+	}
+	buf.WriteString("};\n")
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testVanillaConfig = `class CfgVehicles {
+	class Inventory_Base {
+		weight = 10;
+		hiddenSelections[] = {"camo"};
+		hiddenSelectionsTextures[] = {"dz\gear\data\base_co.paa"};
+		class DamageSystem {
+			class GlobalHealth {};
+		};
+	};
+	class Edible_Base: Inventory_Base {
+		weight = 20;
+		varQuantityMax = 100;
+	};
+};
+`
+
+func testConfigTree(t *testing.T, configs ...string) *ConfigTree {
+	t.Helper()
+
+	tree := NewConfigTree()
+	for i, data := range configs {
+		name := "vanilla.cpp"
+		if i > 0 {
+			name = filepath.Join("gear", "config.cpp")
+		}
+		config, err := ParseConfig(name, []byte(data))
+		require.NoError(t, err)
+		tree.Add(config)
+	}
+	return tree
+}
+
+func TestConfigTree_Properties(t *testing.T) {
+	tree := testConfigTree(t, testVanillaConfig, `class CfgVehicles {
+	class Edible_Base;
+	class WLZ_Cupcake: Edible_Base {
+		displayName = "Cupcake";
+		weight = 30;
+		hiddenSelectionsTextures[] = {"wlz\gear\cupcake_co.paa"};
+		hiddenSelections[] += {"icing"};
+	};
+};
+`)
+
+	class, err := tree.Find("CfgVehicles/WLZ_Cupcake")
+	require.NoError(t, err)
+	properties, err := class.Properties()
+	require.NoError(t, err)
+
+	type property struct {
+		name    string
+		value   string
+		sources []string
+	}
+	var got []property
+	for _, p := range properties {
+		sources := []string{}
+		for _, source := range p.Sources {
+			sources = append(sources, source.String())
+		}
+		got = append(got, property{p.Name, formatConfigValue(p.Value), sources})
+	}
+
+	config := filepath.Join("gear", "config.cpp")
+	assert.Equal(t, []property{
+		{"weight", "30", []string{"WLZ_Cupcake (" + config + ":5)"}},
+		{"hiddenSelections", `{"camo", "icing"}`, []string{"Inventory_Base (vanilla.cpp:4)", "WLZ_Cupcake (" + config + ":7)"}},
+		{"hiddenSelectionsTextures", `{"wlz\gear\cupcake_co.paa"}`, []string{"WLZ_Cupcake (" + config + ":6)"}},
+		{"varQuantityMax", "100", []string{"Edible_Base (vanilla.cpp:12)"}},
+		{"displayName", `"Cupcake"`, []string{"WLZ_Cupcake (" + config + ":4)"}},
+	}, got)
+}
+
+func TestConfigTree_Find(t *testing.T) {
+	tree := testConfigTree(t, testVanillaConfig, `class CfgVehicles {
+	class Inventory_Base;
+	class Clothing;
+	class WLZ_Crate: Inventory_Base {
+		class DamageSystem: DamageSystem {
+			class GlobalArmor {};
+		};
+	};
+	class WLZ_Shirt: Clothing {};
+	class WLZ_Loop: WLZ_Loop {};
+	class WLZ_Missing: WLZ_Nothing {};
+};
+`)
+
+	tests := []struct {
+		path string
+		want string
+		err  string
+	}{
+		{path: "CfgVehicles/WLZ_Crate", want: "CfgVehicles/WLZ_Crate"},
+		{path: "cfgvehicles >> wlz_crate", want: "CfgVehicles/WLZ_Crate"},
+		{path: "CfgVehicles/Edible_Base/DamageSystem", want: "CfgVehicles/Inventory_Base/DamageSystem"},
+		{path: "CfgVehicles/WLZ_Crate/DamageSystem/GlobalHealth", want: "CfgVehicles/Inventory_Base/DamageSystem/GlobalHealth"},
+		{path: "CfgVehicles/WLZ_Cupcake", err: "class WLZ_Cupcake not found in CfgVehicles"},
+		{path: "CfgWeapons", err: "class CfgWeapons not found"},
+		{path: "CfgVehicles/Clothing", err: "class CfgVehicles/Clothing is declared but not defined (load the config defining it with -vanilla)"},
+		{path: "CfgVehicles/WLZ_Missing/x", err: "base class WLZ_Nothing of CfgVehicles/WLZ_Missing is not defined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			class, err := tree.Find(test.path)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, class.Path())
+		})
+	}
+
+	t.Run("base class not loaded", func(t *testing.T) {
+		class, err := tree.Find("CfgVehicles/WLZ_Shirt")
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteEffectiveClass(&buf, class))
+		assert.Equal(t, "// CfgVehicles/WLZ_Shirt -> CfgVehicles/Clothing (not loaded)\nclass WLZ_Shirt: Clothing\n{\n};\n", buf.String())
+	})
+
+	t.Run("class inheriting from itself", func(t *testing.T) {
+		class, err := tree.Find("CfgVehicles/WLZ_Loop")
+		require.NoError(t, err)
+		_, err = class.Properties()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigTree_Merge(t *testing.T) {
+	tree := testConfigTree(t, testVanillaConfig, `class CfgVehicles {
+	class Inventory_Base {
+		weight = 15;
+		hiddenSelections[] += {"zbytek"};
+	};
+	delete Edible_Base;
+};
+`)
+
+	_, err := tree.Find("CfgVehicles/Edible_Base")
+	assert.Error(t, err)
+
+	class, err := tree.Find("CfgVehicles/Inventory_Base")
+	require.NoError(t, err)
+	properties, err := class.Properties()
+	require.NoError(t, err)
+	require.Len(t, properties, 3)
+	assert.Equal(t, ConfigValue{Type: ConfigInt, Int: 15}, properties[0].Value)
+	assert.Equal(t, `{"camo", "zbytek"}`, formatConfigValue(properties[1].Value))
+}
+
+func TestConfigTree_AppendSources(t *testing.T) {
+	tree := testConfigTree(t, testVanillaConfig, `class CfgVehicles {
+	class Inventory_Base {
+		hiddenSelections[] += {"zbytek"};
+	};
+};
+`, `class CfgVehicles {
+	class Inventory_Base {
+		hiddenSelections[] += {"icing"};
+	};
+};
+`)
+
+	class, err := tree.Find("CfgVehicles/Inventory_Base")
+	require.NoError(t, err)
+	properties, err := class.Properties()
+	require.NoError(t, err)
+
+	config := filepath.Join("gear", "config.cpp")
+	require.Equal(t, "hiddenSelections", properties[1].Name)
+	assert.Equal(t, `{"camo", "zbytek", "icing"}`, formatConfigValue(properties[1].Value))
+	var sources []string
+	for _, source := range properties[1].Sources {
+		sources = append(sources, source.String())
+	}
+	assert.Equal(t, []string{"Inventory_Base (vanilla.cpp:4)", "Inventory_Base (" + config + ":3)", "Inventory_Base (" + config + ":3)"}, sources)
+
+	tree = testConfigTree(t, testVanillaConfig, `class CfgVehicles {
+	class Inventory_Base {
+		hiddenSelections[] += {"zbytek"};
+		hiddenSelections[] = {"replaced"};
+	};
+};
+`)
+	class, err = tree.Find("CfgVehicles/Inventory_Base")
+	require.NoError(t, err)
+	properties, err = class.Properties()
+	require.NoError(t, err)
+	assert.Equal(t, `{"replaced"}`, formatConfigValue(properties[1].Value))
+	require.Len(t, properties[1].Sources, 1)
+}
+
+func TestSortByRequiredAddons(t *testing.T) {
+	parse := func(name, config string) *Config {
+		parsed, err := ParseConfig(name, []byte(config))
+		require.NoError(t, err)
+		return parsed
+	}
+	items := parse("items/config.cpp", `class CfgPatches { class WLZ_Items { requiredAddons[] = {"WLZ_Core", "DZ_Data"}; }; };`)
+	core := parse("core/config.cpp", `class CfgPatches { class WLZ_Core { requiredAddons[] = {"DZ_Data"}; }; };`)
+	patch := parse("patch/config.cpp", `class CfgPatches { class WLZ_Patch { requiredAddons[] = {"wlz_items"}; }; };`)
+	other := parse("other/config.cpp", `class CfgPatches { class WLZ_Other {}; };`)
+
+	assert.Equal(t, []*Config{core, items, patch, other}, sortByRequiredAddons([]*Config{patch, items, other, core}))
+
+	a := parse("a/config.cpp", `class CfgPatches { class A { requiredAddons[] = {"B"}; }; };`)
+	b := parse("b/config.cpp", `class CfgPatches { class B { requiredAddons[] = {"A"}; }; };`)
+	assert.Len(t, sortByRequiredAddons([]*Config{a, b}), 2)
+}
+
+func TestWriteEffectiveClass(t *testing.T) {
+	tree := testConfigTree(t, testVanillaConfig, `class CfgVehicles {
+	class Edible_Base;
+	class WLZ_Cupcake: Edible_Base {
+		weight = 30;
+		class DamageSystem {};
+	};
+};
+`)
+
+	class, err := tree.Find("CfgVehicles/WLZ_Cupcake")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteEffectiveClass(&buf, class))
+
+	config := filepath.Join("gear", "config.cpp")
+	assert.Equal(t, `// CfgVehicles/WLZ_Cupcake -> CfgVehicles/Edible_Base -> CfgVehicles/Inventory_Base
+class WLZ_Cupcake: Edible_Base
+{
+	weight = 30; // WLZ_Cupcake (`+config+`:4)
+	hiddenSelections[] = {"camo"}; // Inventory_Base (vanilla.cpp:4)
+	hiddenSelectionsTextures[] = {"dz\gear\data\base_co.paa"}; // Inventory_Base (vanilla.cpp:5)
+	varQuantityMax = 100; // Edible_Base (vanilla.cpp:12)
+	class DamageSystem {...}; // WLZ_Cupcake (`+config+`:5)
+};
+`, buf.String())
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -20,16 +19,21 @@ func shouldConvert(path string) bool {
 	return slices.Contains(formatsToConvert, strings.ToLower(filepath.Ext(path)))
 }
 
-func convertWithPath(src, dst, converter string) error {
+func convertWithPath(src, dst string, converter Converter, profile TextureProfile) error {
 	err := os.MkdirAll(filepath.Dir(dst), 0755)
 	if err != nil {
 		return err
 	}
-	cmd := exec.Command(converter, src, dst)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error converting image: %w\n%s", err, string(out))
-	}
+	return converter.Convert(src, dst, profile)
+}
 
-	return nil
+// conversionHash returns the source hash recorded for a converted image,
+// which covers the converter, its command and the texture profile as well as
+// the image, so changing any of them converts the image again.
+func conversionHash(sourceHash, backend string, converter Converter, profile TextureProfile) string {
+	command := ""
+	if stringer, ok := converter.(fmt.Stringer); ok {
+		command = stringer.String()
+	}
+	return hashData(fmt.Appendf(nil, "%s\t%s\t%s\t%s=%s,%s", sourceHash, backend, command, profile.Suffix, profile.Format, profile.Filter))
 }
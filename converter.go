@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Converter produces a PAA texture at dst from the image at src.
+type Converter interface {
+	Convert(src, dst string, profile TextureProfile) error
+}
+
+// convertFunc adapts a function to the Converter interface.
+type convertFunc func(src, dst string, profile TextureProfile) error
+
+func (f convertFunc) Convert(src, dst string, profile TextureProfile) error {
+	return f(src, dst, profile)
+}
+
+// converterConfig holds the settings the converter backends are built from.
+type converterConfig struct {
+	imageToPAAPath string
+	pal2PacEPath   string
+	command        string
+	commandDir     string
+	env            []string
+}
+
+// converterBackends are the registered converter backends, by name.
+var converterBackends = map[string]func(config converterConfig) (Converter, error){
+	"image-to-paa": func(config converterConfig) (Converter, error) {
+		return execConverter(config.imageToPAAPath, config), nil
+	},
+	"pal2pace": func(config converterConfig) (Converter, error) {
+		return execConverter(config.pal2PacEPath, config), nil
+	},
+	"builtin": func(config converterConfig) (Converter, error) {
+		return convertFunc(encodePAAFile), nil
+	},
+	"command": func(config converterConfig) (Converter, error) {
+		return newCommandConverter(config)
+	},
+}
+
+func converterNames() []string {
+	names := []string{}
+	for name := range converterBackends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// execConverter returns a Converter which runs the executable at path with
+// the source and destination as arguments, as ImageToPAA and Pal2PacE
+// expect. These tools apply their own suffix rules, so the profile is
+// ignored.
+func execConverter(path string, config converterConfig) Converter {
+	return &commandConverter{
+		args: []string{path, "{src}", "{dst}"},
+		dir:  config.commandDir,
+		env:  config.env,
+	}
+}
+
+// commandPlaceholders are the values a command template can refer to. Each
+// also has a :win variant with the path translated for Wine (see
+// windowsPath).
+var commandPlaceholders = []string{"src", "dst", "srcdir", "dstdir", "workdir"}
+
+var placeholderPattern = regexp.MustCompile(`\{[a-z]+(:[a-z]+)?\}`)
+
+// commandConverter runs a command template, such as
+// wine ImageToPAA.exe {src:win} {dst:win}. The arguments, working directory
+// and environment variables may contain placeholders.
+type commandConverter struct {
+	args []string
+	dir  string
+	env  []string
+}
+
+func newCommandConverter(config converterConfig) (*commandConverter, error) {
+	args, err := splitCommand(config.command)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing converter command: %w", err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the command converter requires -converter-command")
+	}
+	for _, value := range append(append(slices.Clone(args), config.commandDir), config.env...) {
+		for _, placeholder := range placeholderPattern.FindAllString(value, -1) {
+			name, variant, _ := strings.Cut(strings.Trim(placeholder, "{}"), ":")
+			if !slices.Contains(commandPlaceholders, name) || (variant != "" && variant != "win") {
+				return nil, fmt.Errorf("unknown placeholder %s in converter command, expected one of {%s} with an optional :win suffix", placeholder, strings.Join(commandPlaceholders, "}, {"))
+			}
+		}
+	}
+	return &commandConverter{args: args, dir: config.commandDir, env: config.env}, nil
+}
+
+func (c *commandConverter) Convert(src, dst string, _ TextureProfile) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	paths := map[string]string{
+		"src":    src,
+		"dst":    dst,
+		"srcdir": filepath.Dir(src),
+		"dstdir": filepath.Dir(dst),
+	}
+	replacements := []string{}
+	for name, path := range paths {
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		replacements = append(replacements, "{"+name+"}", path, "{"+name+":win}", windowsPath(path))
+	}
+	// the working directory can refer to the other paths, so it is
+	// expanded first
+	dir := strings.NewReplacer(replacements...).Replace(c.dir)
+	if dir != "" {
+		workDir, err = filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+	}
+	replacer := strings.NewReplacer(append(replacements, "{workdir}", workDir, "{workdir:win}", windowsPath(workDir))...)
+
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = replacer.Replace(arg)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = workDir
+	if len(c.env) > 0 {
+		cmd.Env = os.Environ()
+		for _, env := range c.env {
+			cmd.Env = append(cmd.Env, replacer.Replace(env))
+		}
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error converting image: %w\n%s", err, string(out))
+	}
+	return nil
+}
+
+// String returns the command template with the executable resolved against
+// $PATH where it can be, with the working directory and environment, so
+// conversions by a different tool or command can be told apart.
+func (c *commandConverter) String() string {
+	args := slices.Clone(c.args)
+	if path, err := exec.LookPath(args[0]); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			args[0] = abs
+		}
+	}
+	return fmt.Sprintf("%q dir=%q env=%q", args, c.dir, c.env)
+}
+
+// windowsPath translates an absolute path for Windows tools run under Wine,
+// where Z: maps to the root of the file system (/home/user becomes
+// Z:\home\user). Paths which already have a drive letter keep it.
+func windowsPath(path string) string {
+	if len(path) >= 2 && path[1] == ':' {
+		return strings.ReplaceAll(path, "/", `\`)
+	}
+	return "Z:" + strings.ReplaceAll(filepath.ToSlash(path), "/", `\`)
+}
+
+// converterEnv implements flag.Value for KEY=VALUE environment variables.
+type converterEnv []string
+
+func (e *converterEnv) String() string {
+	if e == nil {
+		return ""
+	}
+	return strings.Join(*e, " ")
+}
+
+func (e *converterEnv) Set(value string) error {
+	key, _, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", value)
+	}
+	*e = append(*e, value)
+	return nil
+}
+
+// splitCommand splits a command line into arguments on whitespace. Single
+// or double quotes group an argument, and a backslash escapes the next
+// character only inside double quotes, so Windows paths can be written as is.
+func splitCommand(command string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range command {
+		switch {
+		case escaped:
+			if r != '"' && r != '\\' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// ConverterRule selects the converter backend for images matching Pattern.
+type ConverterRule struct {
+	Pattern string
+	Backend string
+}
+
+// ConverterRules implements flag.Value, where each value is pattern=backend.
+// Patterns containing a / are matched against the path within the source
+// directory, other patterns against the file name. Matching ignores case
+// and the first matching rule wins.
+type ConverterRules []ConverterRule
+
+func (r *ConverterRules) String() string {
+	if r == nil {
+		return ""
+	}
+	values := []string{}
+	for _, rule := range *r {
+		values = append(values, rule.Pattern+"="+rule.Backend)
+	}
+	return strings.Join(values, " ")
+}
+
+func (r *ConverterRules) Set(value string) error {
+	pattern, backend, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" {
+		return fmt.Errorf("invalid converter rule %q, expected pattern=backend", value)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid converter pattern %q: %w", pattern, err)
+	}
+	if _, ok := converterBackends[backend]; !ok {
+		return fmt.Errorf("unknown converter %q, expected one of %s", backend, strings.Join(converterNames(), ", "))
+	}
+	*r = append(*r, ConverterRule{Pattern: pattern, Backend: backend})
+	return nil
+}
+
+// Match returns the backend of the first rule matching path.
+func (r ConverterRules) Match(name string) (string, bool) {
+	name = strings.ToLower(filepath.ToSlash(name))
+	for _, rule := range r {
+		pattern := strings.ToLower(rule.Pattern)
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return rule.Backend, true
+		}
+	}
+	return "", false
+}
+
+// Converters picks the converter for each image, from the rules or the
+// default backend. Backends are only built when a rule or the default
+// refers to them.
+type Converters struct {
+	backend    string
+	rules      ConverterRules
+	converters map[string]Converter
+}
+
+func NewConverters(backend string, rules ConverterRules, config converterConfig) (*Converters, error) {
+	c := &Converters{backend: backend, rules: rules, converters: map[string]Converter{}}
+	names := []string{backend}
+	for _, rule := range rules {
+		names = append(names, rule.Backend)
+	}
+	for _, name := range names {
+		if _, ok := c.converters[name]; ok {
+			continue
+		}
+		newConverter, ok := converterBackends[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown converter %q, expected one of %s", name, strings.Join(converterNames(), ", "))
+		}
+		converter, err := newConverter(config)
+		if err != nil {
+			return nil, err
+		}
+		c.converters[name] = converter
+	}
+	return c, nil
+}
+
+// For returns the backend name and converter for the image at path.
+func (c *Converters) For(path string) (string, Converter) {
+	backend, ok := c.rules.Match(path)
+	if !ok {
+		backend = c.backend
+	}
+	return backend, c.converters[backend]
+}
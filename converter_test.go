@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected []string
+	}{
+		{"plain", "magick {src} {dst}", []string{"magick", "{src}", "{dst}"}},
+		{"extra whitespace", "  magick\t{src}   {dst} ", []string{"magick", "{src}", "{dst}"}},
+		{"double quotes", `"C:\Program Files\Tool\tool.exe" {src}`, []string{`C:\Program Files\Tool\tool.exe`, "{src}"}},
+		{"single quotes", `tool '-o {dst}'`, []string{"tool", "-o {dst}"}},
+		{"escaped quote", `tool "say \"hi\""`, []string{"tool", `say "hi"`}},
+		{"unquoted backslashes", `C:\Tools\tool.exe {src}`, []string{`C:\Tools\tool.exe`, "{src}"}},
+		{"empty argument", `tool ""`, []string{"tool", ""}},
+		{"empty", "", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := splitCommand(test.command)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, args)
+		})
+	}
+
+	t.Run("rejects unterminated quotes", func(t *testing.T) {
+		_, err := splitCommand(`tool "{src}`)
+		assert.Error(t, err)
+	})
+}
+
+func TestConverterRules(t *testing.T) {
+	rules := ConverterRules{}
+	require.NoError(t, rules.Set("*_nohq.png=image-to-paa"))
+	require.NoError(t, rules.Set("data/ui/*=pal2pace"))
+	require.NoError(t, rules.Set("*.png=builtin"))
+
+	tests := []struct {
+		path     string
+		expected string
+		ok       bool
+	}{
+		{"data/cupcake_NOHQ.png", "image-to-paa", true},
+		{"data/ui/logo.png", "pal2pace", true},
+		{"data/ui/nested/logo.png", "builtin", true},
+		{"data/cupcake_co.png", "builtin", true},
+		{"data/cupcake_co.jpg", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			backend, ok := rules.Match(test.path)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, backend)
+		})
+	}
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		for _, value := range []string{"*.png", "=builtin", "[.png=builtin", "*.png=magic"} {
+			assert.Error(t, rules.Set(value), value)
+		}
+		assert.Len(t, rules, 3)
+	})
+}
+
+func TestConverters(t *testing.T) {
+	t.Run("picks the rule backend or the default", func(t *testing.T) {
+		rules := ConverterRules{{Pattern: "*_nohq.png", Backend: "image-to-paa"}}
+		converters, err := NewConverters("builtin", rules, converterConfig{imageToPAAPath: "ImageToPAA.exe"})
+		require.NoError(t, err)
+
+		backend, converter := converters.For("data/cupcake_nohq.png")
+		assert.Equal(t, "image-to-paa", backend)
+		assert.NotNil(t, converter)
+
+		backend, converter = converters.For("data/cupcake_co.png")
+		assert.Equal(t, "builtin", backend)
+		assert.NotNil(t, converter)
+	})
+
+	t.Run("rejects unknown backends", func(t *testing.T) {
+		_, err := NewConverters("magic", nil, converterConfig{})
+		assert.ErrorContains(t, err, "unknown converter")
+	})
+
+	t.Run("requires a command for the command backend", func(t *testing.T) {
+		_, err := NewConverters("command", nil, converterConfig{})
+		assert.ErrorContains(t, err, "-converter-command")
+	})
+
+	t.Run("runs command templates", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		src := filepath.Join(tmpDir, "cupcake_co.png")
+		dst := filepath.Join(tmpDir, "cupcake_co.paa")
+		require.NoError(t, os.WriteFile(src, []byte("image"), 0644))
+
+		converters, err := NewConverters("command", nil, converterConfig{command: "cp {src} {dst}"})
+		require.NoError(t, err)
+		_, converter := converters.For(src)
+		require.NoError(t, converter.Convert(src, dst, defaultTextureProfile))
+
+		data, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, "image", string(data))
+	})
+
+	t.Run("expands placeholders in the arguments, directory and environment", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		src := filepath.Join(tmpDir, "data", "cupcake_co.png")
+		dst := filepath.Join(tmpDir, "out", "cupcake_co.paa")
+		require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0755))
+
+		converters, err := NewConverters("command", nil, converterConfig{
+			command:    `sh -c 'printf "%s %s %s\n" "$TEXTURE" "$0" "$1" > cupcake_co.paa' {src:win} {workdir}`,
+			commandDir: "{dstdir}",
+			env:        []string{"TEXTURE={srcdir}"},
+		})
+		require.NoError(t, err)
+		_, converter := converters.For(src)
+		require.NoError(t, converter.Convert(src, dst, defaultTextureProfile))
+
+		data, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		expected := filepath.Dir(src) + " " + windowsPath(src) + " " + filepath.Dir(dst) + "\n"
+		assert.Equal(t, expected, string(data))
+	})
+
+	t.Run("rejects unknown placeholders", func(t *testing.T) {
+		for _, config := range []converterConfig{
+			{command: "tool {source}"},
+			{command: "tool {src:unix}"},
+			{command: "tool", env: []string{"DIR={home}"}},
+		} {
+			_, err := NewConverters("command", nil, config)
+			assert.ErrorContains(t, err, "unknown placeholder")
+		}
+	})
+}
+
+func TestWindowsPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/home/user/P/cupcake_co.paa", `Z:\home\user\P\cupcake_co.paa`},
+		{"/", `Z:\`},
+		{`C:\Tools\ImageToPAA.exe`, `C:\Tools\ImageToPAA.exe`},
+		{"P:/WILDLANDZ/data", `P:\WILDLANDZ\data`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			assert.Equal(t, test.expected, windowsPath(test.path))
+		})
+	}
+}
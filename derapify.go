@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newDerapifyCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build derapify", flag.ExitOnError)
+	output := flags.String("output", "", "File to write the config to (defaults to standard output)")
+
+	return &ffcli.Command{
+		Name:       "derapify",
+		ShortUsage: "mod-build derapify [options] <config.bin>",
+		ShortHelp:  "Convert a rapified config back to text",
+		LongHelp:   "Convert a rapified config, such as config.bin or a binarized .rvmat, back to text.",
+		UsageFunc:  usage,
+		FlagSet:    flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				fmt.Fprintln(os.Stderr, "error: rapified config file is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return derapifyFile(args[0], *output)
+		},
+	}
+}
+
+func derapifyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	config, err := Derapify(data)
+	if err != nil {
+		return fmt.Errorf("error derapifying %q: %w", src, err)
+	}
+
+	if dst == "" {
+		return WriteConfig(os.Stdout, config)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	err = WriteConfig(out, config)
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Derapify reads a rapified config, as written by Rapify.
+func Derapify(data []byte) (*Config, error) {
+	if len(data) < 16 || string(data[:4]) != rapSignature {
+		return nil, fmt.Errorf("not a rapified config")
+	}
+
+	r := &rapReader{data: data, pos: 16}
+	config := &Config{Root: &ConfigClass{}}
+	err := r.readClass(config.Root, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r.pos = int(binary.LittleEndian.Uint32(data[12:]))
+	if r.pos == 0 || r.pos == len(data) {
+		// some tools write no enum table
+		return config, nil
+	}
+	count, err := r.uint32()
+	if err != nil {
+		return nil, fmt.Errorf("error reading enums: %w", err)
+	}
+	for i := uint32(0); i < count; i++ {
+		name, err := r.string()
+		if err != nil {
+			return nil, fmt.Errorf("error reading enums: %w", err)
+		}
+		value, err := r.uint32()
+		if err != nil {
+			return nil, fmt.Errorf("error reading enums: %w", err)
+		}
+		config.Enums = append(config.Enums, ConfigEnum{Name: name, Value: int32(value)})
+	}
+	return config, nil
+}
+
+type rapReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *rapReader) errorf(format string, args ...any) error {
+	return fmt.Errorf("at offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+}
+
+func (r *rapReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, r.errorf("unexpected end of data")
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+func (r *rapReader) uint32() (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, r.errorf("unexpected end of data")
+	}
+	r.pos += 4
+	return binary.LittleEndian.Uint32(r.data[r.pos-4:]), nil
+}
+
+func (r *rapReader) string() (string, error) {
+	for end := r.pos; end < len(r.data); end++ {
+		if r.data[end] == 0 {
+			s := string(r.data[r.pos:end])
+			r.pos = end + 1
+			return s, nil
+		}
+	}
+	return "", r.errorf("unterminated string")
+}
+
+func (r *rapReader) compressedInt() (int, error) {
+	n := 0
+	for shift := 0; shift < 32; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return 0, r.errorf("invalid compressed integer")
+}
+
+// readClass reads the class body at the current position. Class entries
+// point to their bodies, which are read before continuing with the next
+// entry.
+func (r *rapReader) readClass(class *ConfigClass, depth int) error {
+	if depth > 256 {
+		return r.errorf("classes are nested too deeply")
+	}
+
+	var err error
+	class.Base, err = r.string()
+	if err != nil {
+		return err
+	}
+	count, err := r.compressedInt()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		entry := ConfigEntry{Kind: ConfigEntryKind(kind)}
+		switch entry.Kind {
+		case ConfigClassEntry:
+			entry.Name, err = r.string()
+			if err != nil {
+				return err
+			}
+			offset, err := r.uint32()
+			if err != nil {
+				return err
+			}
+			if int(offset) >= len(r.data) {
+				return r.errorf("class %s body is out of range", entry.Name)
+			}
+			entry.Class = &ConfigClass{Name: entry.Name}
+			next := r.pos
+			r.pos = int(offset)
+			err = r.readClass(entry.Class, depth+1)
+			if err != nil {
+				return err
+			}
+			r.pos = next
+		case ConfigValueEntry:
+			valueType, err := r.byte()
+			if err != nil {
+				return err
+			}
+			entry.Name, err = r.string()
+			if err != nil {
+				return err
+			}
+			// subtype 4 is a variable, which has no text form that rapifies
+			// back to it
+			if valueType == 4 {
+				return r.errorf("%s is a variable (value type 4), which can't be written as text", entry.Name)
+			}
+			if valueType > byte(ConfigInt) {
+				return r.errorf("unknown value type %d for %s", valueType, entry.Name)
+			}
+			entry.Value, err = r.scalar(ConfigValueType(valueType), depth)
+			if err != nil {
+				return err
+			}
+		case ConfigArrayEntry, ConfigAppendEntry:
+			if entry.Kind == ConfigAppendEntry {
+				if _, err := r.uint32(); err != nil {
+					return err
+				}
+			}
+			entry.Name, err = r.string()
+			if err != nil {
+				return err
+			}
+			entry.Value, err = r.array(depth)
+			if err != nil {
+				return err
+			}
+		case ConfigExternEntry, ConfigDeleteEntry:
+			entry.Name, err = r.string()
+			if err != nil {
+				return err
+			}
+		default:
+			return r.errorf("unknown entry type %d", kind)
+		}
+		class.Entries = append(class.Entries, entry)
+	}
+	return nil
+}
+
+func (r *rapReader) scalar(valueType ConfigValueType, depth int) (ConfigValue, error) {
+	value := ConfigValue{Type: valueType}
+	var err error
+	switch valueType {
+	case ConfigString:
+		value.String, err = r.string()
+	case ConfigFloat:
+		var bits uint32
+		bits, err = r.uint32()
+		value.Float = math.Float32frombits(bits)
+		// configs have no syntax for NaN and infinities
+		if err == nil && (math.IsNaN(float64(value.Float)) || math.IsInf(float64(value.Float), 0)) {
+			err = r.errorf("float %v can't be written as text", value.Float)
+		}
+	case ConfigInt:
+		var n uint32
+		n, err = r.uint32()
+		value.Int = int32(n)
+	case ConfigArray:
+		value, err = r.array(depth + 1)
+	}
+	return value, err
+}
+
+func (r *rapReader) array(depth int) (ConfigValue, error) {
+	if depth > 256 {
+		return ConfigValue{}, r.errorf("arrays are nested too deeply")
+	}
+	count, err := r.compressedInt()
+	if err != nil {
+		return ConfigValue{}, err
+	}
+	array := ConfigValue{Type: ConfigArray, Array: []ConfigValue{}}
+	for i := 0; i < count; i++ {
+		valueType, err := r.byte()
+		if err != nil {
+			return ConfigValue{}, err
+		}
+		if valueType == 4 {
+			return ConfigValue{}, r.errorf("array element is a variable (value type 4), which can't be written as text")
+		}
+		if valueType > byte(ConfigArray) {
+			return ConfigValue{}, r.errorf("unknown array element type %d", valueType)
+		}
+		value, err := r.scalar(ConfigValueType(valueType), depth)
+		if err != nil {
+			return ConfigValue{}, err
+		}
+		array.Array = append(array.Array, value)
+	}
+	return array, nil
+}
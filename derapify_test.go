@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+enum { DestructNo, DestructEngine = 5 };
+class CfgPatches
+{
+	class WILDLANDZ_Anniversary
+	{
+		units[] = {"WLZ_Cupcake"};
+		requiredVersion = 0.1;
+		requiredAddons[] = {"DZ_Data", "DZ_Gear_Food"};
+	};
+};
+class CfgVehicles
+{
+	class Inventory_Base;
+	class WLZ_Cupcake: Inventory_Base
+	{
+		scope = 2;
+		weight = 1.0;
+		displayName = "Cupcake ""deluxe""";
+		destrType = DestructEngine;
+		hiddenSelectionsTextures[] += {{1, -2.5}, "a"};
+		delete Rotten;
+		class Empty {};
+	};
+};
+`
+
+func TestDerapify(t *testing.T) {
+	t.Run("round trips rapified configs", func(t *testing.T) {
+		config, err := ParseConfig("config.cpp", []byte(testConfig))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, Rapify(&buf, config))
+
+		derapified, err := Derapify(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, testWithoutPositions(config), derapified)
+	})
+
+	t.Run("rejects files which are not rapified", func(t *testing.T) {
+		_, err := Derapify([]byte("class CfgPatches {};"))
+		assert.EqualError(t, err, "not a rapified config")
+	})
+
+	// values without a text form which rapifies back to them
+	unsupportedTests := []struct {
+		name     string
+		config   string
+		patch    func(data []byte)
+		expected string
+	}{
+		{
+			name:   "variables",
+			config: "value = \"x\";",
+			patch: func(data []byte) {
+				// the value type before the name
+				data[bytes.Index(data, []byte("value\x00"))-1] = 4
+			},
+			expected: "value is a variable (value type 4), which can't be written as text",
+		},
+		{
+			name:   "variables in arrays",
+			config: "values[] = {\"x\"};",
+			patch: func(data []byte) {
+				// the element type before the string
+				data[bytes.Index(data, []byte("x\x00"))-1] = 4
+			},
+			expected: "array element is a variable (value type 4), which can't be written as text",
+		},
+		{
+			name:   "NaN",
+			config: "value = 1.5;",
+			patch: func(data []byte) {
+				binary.LittleEndian.PutUint32(data[bytes.Index(data, []byte{0x00, 0x00, 0xc0, 0x3f}):], math.Float32bits(float32(math.NaN())))
+			},
+			expected: "float NaN can't be written as text",
+		},
+		{
+			name:   "infinity",
+			config: "values[] = {1.5};",
+			patch: func(data []byte) {
+				binary.LittleEndian.PutUint32(data[bytes.Index(data, []byte{0x00, 0x00, 0xc0, 0x3f}):], math.Float32bits(float32(math.Inf(-1))))
+			},
+			expected: "float -Inf can't be written as text",
+		},
+	}
+	for _, test := range unsupportedTests {
+		t.Run("rejects "+test.name, func(t *testing.T) {
+			config, err := ParseConfig("config.cpp", []byte(test.config))
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, Rapify(&buf, config))
+			data := buf.Bytes()
+			test.patch(data)
+
+			_, err = Derapify(data)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		})
+	}
+
+	t.Run("rejects truncated files", func(t *testing.T) {
+		config, err := ParseConfig("config.cpp", []byte(testConfig))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, Rapify(&buf, config))
+
+		_, err = Derapify(buf.Bytes()[:60])
+		assert.Error(t, err)
+	})
+}
+
+func TestWriteConfig(t *testing.T) {
+	config, err := ParseConfig("config.cpp", []byte(testConfig))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteConfig(&buf, config))
+	assert.Equal(t, `enum
+{
+	DestructNo = 0,
+	DestructEngine = 5
+};
+class CfgPatches
+{
+	class WILDLANDZ_Anniversary
+	{
+		units[] = {"WLZ_Cupcake"};
+		requiredVersion = 0.1;
+		requiredAddons[] = {"DZ_Data", "DZ_Gear_Food"};
+	};
+};
+class CfgVehicles
+{
+	class Inventory_Base;
+	class WLZ_Cupcake: Inventory_Base
+	{
+		scope = 2;
+		weight = 1.0;
+		displayName = "Cupcake ""deluxe""";
+		destrType = 5;
+		hiddenSelectionsTextures[] += {{1, -2.5}, "a"};
+		delete Rotten;
+		class Empty {};
+	};
+};
+`, buf.String())
+
+	reparsed, err := ParseConfig("config.cpp", buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, testWithoutPositions(config), testWithoutPositions(reparsed))
+}
+
+// testWithoutPositions returns a copy of config without entry positions, as
+// they are not stored in rapified configs.
+func testWithoutPositions(config *Config) *Config {
+	var strip func(class *ConfigClass) *ConfigClass
+	strip = func(class *ConfigClass) *ConfigClass {
+		stripped := &ConfigClass{Name: class.Name, Base: class.Base}
+		for _, entry := range class.Entries {
+			entry.Pos = ConfigPos{}
+			if entry.Class != nil {
+				entry.Class = strip(entry.Class)
+			}
+			stripped.Entries = append(stripped.Entries, entry)
+		}
+		return stripped
+	}
+	return &Config{Root: strip(config.Root), Enums: config.Enums}
+}
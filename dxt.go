@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+)
+
+// Block compression for DXT1 (BC1) and DXT5 (BC3) textures. Colour endpoints
+// are fitted along the principal axis of each 4x4 block.
+
+// compressDXT1 encodes img as opaque DXT1 blocks.
+func compressDXT1(img *image.NRGBA) []byte {
+	out := []byte{}
+	forEachBlock(img, func(block *[16][4]uint8) {
+		out = appendColorBlock(out, block)
+	})
+	return out
+}
+
+// compressDXT5 encodes img as DXT5 blocks, with interpolated alpha.
+func compressDXT5(img *image.NRGBA) []byte {
+	out := []byte{}
+	forEachBlock(img, func(block *[16][4]uint8) {
+		out = appendAlphaBlock(out, block)
+		out = appendColorBlock(out, block)
+	})
+	return out
+}
+
+// forEachBlock calls fn with the pixels of each 4x4 block of img, in row
+// order. Blocks overhanging the image edge repeat the edge pixels.
+func forEachBlock(img *image.NRGBA, fn func(block *[16][4]uint8)) {
+	bounds := img.Bounds()
+	var block [16][4]uint8
+	for by := 0; by < bounds.Dy(); by += 4 {
+		for bx := 0; bx < bounds.Dx(); bx += 4 {
+			for i := range block {
+				x := min(bx+i%4, bounds.Dx()-1)
+				y := min(by+i/4, bounds.Dy()-1)
+				offset := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+				copy(block[i][:], img.Pix[offset:offset+4])
+			}
+			fn(&block)
+		}
+	}
+}
+
+func appendColorBlock(out []byte, block *[16][4]uint8) []byte {
+	lo, hi := colorEndpoints(block)
+	c0, c1 := packRGB565(hi), packRGB565(lo)
+
+	var indices uint32
+	if c0 != c1 {
+		if c0 < c1 {
+			c0, c1 = c1, c0
+		}
+		palette := colorPalette(c0, c1)
+		for i, pixel := range block {
+			best, bestDistance := 0, math.MaxInt
+			for j, color := range palette {
+				distance := 0
+				for k := 0; k < 3; k++ {
+					d := int(pixel[k]) - int(color[k])
+					distance += d * d
+				}
+				if distance < bestDistance {
+					best, bestDistance = j, distance
+				}
+			}
+			indices |= uint32(best) << (2 * i)
+		}
+	}
+
+	out = binary.LittleEndian.AppendUint16(out, c0)
+	out = binary.LittleEndian.AppendUint16(out, c1)
+	return binary.LittleEndian.AppendUint32(out, indices)
+}
+
+// colorEndpoints projects the block onto its principal colour axis and
+// returns the colours at either end.
+func colorEndpoints(block *[16][4]uint8) ([3]float64, [3]float64) {
+	var mean [3]float64
+	for _, pixel := range block {
+		for k := 0; k < 3; k++ {
+			mean[k] += float64(pixel[k]) / 16
+		}
+	}
+
+	var covariance [3][3]float64
+	for _, pixel := range block {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				covariance[i][j] += (float64(pixel[i]) - mean[i]) * (float64(pixel[j]) - mean[j])
+			}
+		}
+	}
+
+	axis := [3]float64{1, 1, 1}
+	for iteration := 0; iteration < 8; iteration++ {
+		var next [3]float64
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				next[i] += covariance[i][j] * axis[j]
+			}
+		}
+		length := math.Sqrt(next[0]*next[0] + next[1]*next[1] + next[2]*next[2])
+		if length == 0 {
+			break
+		}
+		for i := range axis {
+			axis[i] = next[i] / length
+		}
+	}
+
+	minProjection, maxProjection := math.Inf(1), math.Inf(-1)
+	for _, pixel := range block {
+		projection := 0.0
+		for k := 0; k < 3; k++ {
+			projection += (float64(pixel[k]) - mean[k]) * axis[k]
+		}
+		minProjection = min(minProjection, projection)
+		maxProjection = max(maxProjection, projection)
+	}
+
+	var lo, hi [3]float64
+	for k := 0; k < 3; k++ {
+		lo[k] = mean[k] + axis[k]*minProjection
+		hi[k] = mean[k] + axis[k]*maxProjection
+	}
+	return lo, hi
+}
+
+func packRGB565(color [3]float64) uint16 {
+	quantize := func(v float64, levels float64) uint16 {
+		return uint16(math.Round(math.Max(0, math.Min(255, v)) * levels / 255))
+	}
+	return quantize(color[0], 31)<<11 | quantize(color[1], 63)<<5 | quantize(color[2], 31)
+}
+
+func unpackRGB565(c uint16) [3]uint8 {
+	r, g, b := uint8(c>>11&0x1f), uint8(c>>5&0x3f), uint8(c&0x1f)
+	return [3]uint8{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2}
+}
+
+// colorPalette returns the four colours of a block in four colour mode.
+func colorPalette(c0, c1 uint16) [4][3]uint8 {
+	a, b := unpackRGB565(c0), unpackRGB565(c1)
+	var palette [4][3]uint8
+	palette[0], palette[1] = a, b
+	for k := 0; k < 3; k++ {
+		palette[2][k] = uint8((2*int(a[k]) + int(b[k])) / 3)
+		palette[3][k] = uint8((int(a[k]) + 2*int(b[k])) / 3)
+	}
+	return palette
+}
+
+func appendAlphaBlock(out []byte, block *[16][4]uint8) []byte {
+	a0, a1 := uint8(0), uint8(255)
+	for _, pixel := range block {
+		a0 = max(a0, pixel[3])
+		a1 = min(a1, pixel[3])
+	}
+
+	var indices uint64
+	if a0 != a1 {
+		palette := alphaPalette(a0, a1)
+		for i, pixel := range block {
+			best, bestDistance := 0, math.MaxInt
+			for j, alpha := range palette {
+				distance := int(pixel[3]) - int(alpha)
+				if distance < 0 {
+					distance = -distance
+				}
+				if distance < bestDistance {
+					best, bestDistance = j, distance
+				}
+			}
+			indices |= uint64(best) << (3 * i)
+		}
+	}
+
+	out = append(out, a0, a1)
+	for i := 0; i < 6; i++ {
+		out = append(out, byte(indices>>(8*i)))
+	}
+	return out
+}
+
+// alphaPalette returns the eight alpha values of a block where a0 > a1.
+func alphaPalette(a0, a1 uint8) [8]uint8 {
+	var palette [8]uint8
+	palette[0], palette[1] = a0, a1
+	for i := 1; i < 7; i++ {
+		palette[i+1] = uint8(((7-i)*int(a0) + i*int(a1)) / 7)
+	}
+	return palette
+}
+
+// decompressDXT1 decodes DXT1 blocks into an image of the given size.
+func decompressDXT1(width, height int, data []byte) *image.NRGBA {
+	return decompressBlocks(width, height, data, 8, func(block []byte, pixels *[16][4]uint8) {
+		decodeColorBlock(block, pixels, true)
+	})
+}
+
+// decompressDXT5 decodes DXT5 blocks into an image of the given size.
+func decompressDXT5(width, height int, data []byte) *image.NRGBA {
+	return decompressBlocks(width, height, data, 16, func(block []byte, pixels *[16][4]uint8) {
+		decodeColorBlock(block[8:], pixels, false)
+		decodeAlphaBlock(block, pixels)
+	})
+}
+
+func decompressBlocks(width, height int, data []byte, blockSize int, decode func(block []byte, pixels *[16][4]uint8)) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var pixels [16][4]uint8
+	for by := 0; by < height; by += 4 {
+		for bx := 0; bx < width; bx += 4 {
+			decode(data[:blockSize], &pixels)
+			data = data[blockSize:]
+			for i, pixel := range pixels {
+				x, y := bx+i%4, by+i/4
+				if x < width && y < height {
+					copy(img.Pix[img.PixOffset(x, y):], pixel[:])
+				}
+			}
+		}
+	}
+	return img
+}
+
+// decodeColorBlock decodes a colour block. In DXT1, blocks whose first
+// endpoint is not greater than the second have three colours and a
+// transparent index.
+func decodeColorBlock(block []byte, pixels *[16][4]uint8, dxt1 bool) {
+	c0 := binary.LittleEndian.Uint16(block[0:])
+	c1 := binary.LittleEndian.Uint16(block[2:])
+	indices := binary.LittleEndian.Uint32(block[4:])
+
+	palette := colorPalette(c0, c1)
+	alpha := [4]uint8{0xff, 0xff, 0xff, 0xff}
+	if dxt1 && c0 <= c1 {
+		a, b := unpackRGB565(c0), unpackRGB565(c1)
+		for k := 0; k < 3; k++ {
+			palette[2][k] = uint8((int(a[k]) + int(b[k])) / 2)
+			palette[3][k] = 0
+		}
+		alpha[3] = 0
+	}
+
+	for i := range pixels {
+		index := indices >> (2 * i) & 3
+		pixels[i] = [4]uint8{palette[index][0], palette[index][1], palette[index][2], alpha[index]}
+	}
+}
+
+func decodeAlphaBlock(block []byte, pixels *[16][4]uint8) {
+	a0, a1 := block[0], block[1]
+	var palette [8]uint8
+	if a0 > a1 {
+		palette = alphaPalette(a0, a1)
+	} else {
+		palette[0], palette[1] = a0, a1
+		for i := 1; i < 5; i++ {
+			palette[i+1] = uint8(((5-i)*int(a0) + i*int(a1)) / 5)
+		}
+		palette[6], palette[7] = 0, 0xff
+	}
+
+	var indices uint64
+	for i := 0; i < 6; i++ {
+		indices |= uint64(block[2+i]) << (8 * i)
+	}
+	for i := range pixels {
+		pixels[i][3] = palette[indices>>(3*i)&7]
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newExtractCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build extract", flag.ExitOnError)
+	list := flags.Bool("list", false, "List the header properties and entries without extracting")
+
+	return &ffcli.Command{
+		Name:       "extract",
+		ShortUsage: "mod-build extract [options] <file.pbo> [<directory>]",
+		ShortHelp:  "Extract the files from a PBO",
+		LongHelp: "Extract the files from a PBO into a directory which can be used as a build\n" +
+			"source. The prefix is written to " + prefixFile + ". The directory defaults to\n" +
+			"the PBO name without its extension.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				fmt.Fprintln(os.Stderr, "error: pbo file is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			dst := strings.TrimSuffix(args[0], filepath.Ext(args[0]))
+			if len(args) == 2 {
+				dst = args[1]
+			}
+			return extract(args[0], dst, *list)
+		},
+	}
+}
+
+func extract(src, dst string, list bool) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pbo, err := NewPBOReader(f)
+	if err != nil {
+		return err
+	}
+
+	for _, property := range pbo.Properties {
+		fmt.Printf("🏷️ Property   : %s = %s\n", property.Key, property.Value)
+	}
+	for _, entry := range pbo.Entries {
+		timestamp := time.Unix(int64(entry.Timestamp), 0).UTC().Format(time.RFC3339)
+		if entry.PackingMethod == pboMethodCompressed {
+			fmt.Printf("📄 Entry      : \"%s\" (%d bytes, %d unpacked, %s)\n", entry.Name, entry.DataSize, entry.OriginalSize, timestamp)
+		} else {
+			fmt.Printf("📄 Entry      : \"%s\" (%d bytes, %s)\n", entry.Name, entry.DataSize, timestamp)
+		}
+	}
+
+	stored, err := pbo.Checksum()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ %v\n", err)
+	} else {
+		computed, err := pbo.ComputeChecksum()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(stored, computed) {
+			fmt.Fprintf(os.Stderr, "⚠️ Checksum mismatch: stored %x, computed %x\n", stored, computed)
+		}
+	}
+
+	if list {
+		return nil
+	}
+
+	hasPrefixFile := false
+	var notBuilt []string
+	for i, entry := range pbo.Entries {
+		path := filepath.FromSlash(strings.ReplaceAll(entry.Name, `\`, "/"))
+		if !filepath.IsLocal(path) {
+			return fmt.Errorf("error: refusing to extract %q outside of the output directory", entry.Name)
+		}
+		if strings.EqualFold(path, prefixFile) {
+			hasPrefixFile = true
+		} else if !isBuilt(path) {
+			notBuilt = append(notBuilt, path)
+		}
+
+		data, err := pbo.ReadFile(i)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("📤 Extracting : %q\n", path)
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dst, path)), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dst, path), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, path := range notBuilt {
+		if strings.EqualFold(filepath.Base(path), "config.bin") {
+			fmt.Fprintf(os.Stderr, "⚠️ %q is not copied by a build, use derapify to convert it to a config.cpp\n", path)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "⚠️ %q is not copied by a build, as %s files are not part of the source\n", path, filepath.Ext(path))
+	}
+
+	if prefix := pbo.Prefix(); prefix != "" && !hasPrefixFile {
+		fmt.Printf("🏷️ Writing    : %q\n", prefixFile)
+		err = os.MkdirAll(dst, 0755)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, prefixFile), []byte(prefix+"\n"), 0644)
+	}
+
+	return nil
+}
+
+// isBuilt reports whether a build copies or converts the file at path.
+func isBuilt(path string) bool {
+	return shouldCopy(path) || shouldConvert(path)
+}
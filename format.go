@@ -0,0 +1,769 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newFmtCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "Only report files which are not formatted, and fail if there are any")
+
+	return &ffcli.Command{
+		Name:       "fmt",
+		ShortUsage: "mod-build fmt [options] <path>...",
+		ShortHelp:  "Format configs in the canonical style",
+		LongHelp: "Format configs in the canonical style: tab indentation, braces on their own\n" +
+			"lines, one entry per line and consistent spacing. Comments and preprocessor\n" +
+			"directives are kept. Directories are searched for config.cpp and .hpp files.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				fmt.Fprintln(os.Stderr, "error: at least one file or directory is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return formatFiles(args, *check)
+		},
+	}
+}
+
+func formatFiles(paths []string, check bool) error {
+	var files []string
+	for _, path := range paths {
+		finfo, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !finfo.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isFormattable(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	unformatted := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		formatted, err := FormatConfig(path, data)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(data, formatted) {
+			continue
+		}
+
+		if check {
+			fmt.Fprintf(os.Stderr, "❌ Unformatted: %q\n", path)
+			unformatted++
+			continue
+		}
+		fmt.Printf("📝 Formatting : %q\n", path)
+		err = os.WriteFile(path, formatted, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("found %d unformatted files", unformatted)
+	}
+	return nil
+}
+
+// isFormattable reports whether path is a config which is formatted when
+// found in a directory.
+func isFormattable(path string) bool {
+	return isRapifiable(path) || strings.EqualFold(filepath.Ext(path), ".hpp")
+}
+
+// maxArrayLineLength is the length, with tabs counted as four columns, past
+// which an array is written one element per line.
+const maxArrayLineLength = 100
+
+// FormatConfig formats the config in data in the canonical style. The
+// config is formatted as text rather than parsed, so comments, preprocessor
+// directives and macros are kept. The result is checked to have the same
+// tokens, and if the config parses, to parse to the same config.
+func FormatConfig(file string, data []byte) ([]byte, error) {
+	bom := []byte("\ufeff")
+	text := strings.TrimPrefix(string(data), string(bom))
+
+	tokens, err := formatTokens(file, text)
+	if err != nil {
+		return nil, err
+	}
+	f := &configFormatter{file: file, tokens: tokens}
+	err = f.body(0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	out := f.out.String()
+	after, err := formatTokens(file, out)
+	if err != nil || !sameTokens(tokens, after) {
+		return nil, fmt.Errorf("%s: formatting would change the config", file)
+	}
+	if strings.Contains(text, "\r\n") {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	if bytes.HasPrefix(data, bom) {
+		out = string(bom) + out
+	}
+
+	if before, err := rapifyBytes(file, data); err == nil {
+		after, err := rapifyBytes(file, []byte(out))
+		if err != nil || !bytes.Equal(before, after) {
+			return nil, fmt.Errorf("%s: formatting would change the config", file)
+		}
+	}
+	return []byte(out), nil
+}
+
+// sameTokens reports whether a and b are the same tokens, ignoring
+// whitespace and comments, so configs which can't be parsed, because of
+// includes or macros, are checked as well.
+func sameTokens(a, b []formatToken) bool {
+	a, b = codeTokens(a), codeTokens(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].kind != b[i].kind || a[i].text != b[i].text {
+			return false
+		}
+	}
+	return true
+}
+
+// codeTokens returns tokens without comments, and without the semicolons
+// and commas the formatter adds or drops: semicolons after a closing brace
+// or another semicolon, and commas before a closing brace.
+func codeTokens(tokens []formatToken) []formatToken {
+	var code []formatToken
+	for i, token := range tokens {
+		switch {
+		case token.kind == formatComment:
+			continue
+		case token.kind == formatPunct && token.text == ";":
+			if len(code) == 0 || code[len(code)-1].kind == formatPunct && strings.Contains("{};", code[len(code)-1].text) {
+				continue
+			}
+		case token.kind == formatPunct && token.text == ",":
+			if next := nextCodeToken(tokens[i+1:]); next != nil && next.kind == formatPunct && next.text == "}" {
+				continue
+			}
+		}
+		code = append(code, token)
+	}
+	return code
+}
+
+func nextCodeToken(tokens []formatToken) *formatToken {
+	for i := range tokens {
+		if tokens[i].kind != formatComment {
+			return &tokens[i]
+		}
+	}
+	return nil
+}
+
+// rapifyBytes parses and rapifies a config, to compare configs regardless
+// of their layout.
+func rapifyBytes(file string, data []byte) ([]byte, error) {
+	config, err := ParseConfig(file, bytes.TrimPrefix(data, []byte("\ufeff")))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = Rapify(&buf, config)
+	return buf.Bytes(), err
+}
+
+type formatTokenKind int
+
+const (
+	formatWord formatTokenKind = iota
+	formatString
+	formatPunct
+	formatComment
+	formatDirective
+)
+
+// formatToken is a token of a config being formatted, with the whitespace
+// before it.
+type formatToken struct {
+	kind    formatTokenKind
+	text    string
+	line    int
+	space   string // whitespace before the token on the same line
+	newline bool   // first token on its line
+	blank   bool   // preceded by a blank line
+}
+
+const formatPunctuation = "{};,=:[]()"
+
+func formatTokens(file, text string) ([]formatToken, error) {
+	var tokens []formatToken
+	line := 1
+	newlines := 1
+	space := ""
+	errorf := func(line int, format string, args ...any) error {
+		return &ConfigError{Pos: ConfigPos{File: file, Line: line}, Err: fmt.Sprintf(format, args...)}
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch c {
+		case '\n':
+			newlines++
+			line++
+			space = ""
+			i++
+			continue
+		case ' ', '\t', '\r':
+			space += string(c)
+			i++
+			continue
+		}
+
+		token := formatToken{line: line, space: strings.TrimSuffix(space, "\r"), newline: newlines > 0, blank: newlines > 1 && len(tokens) > 0}
+		start := i
+		switch {
+		case c == '#' && newlines > 0:
+			token.kind = formatDirective
+			for i < len(text) && text[i] != '\n' {
+				if text[i] == '\\' && strings.HasPrefix(strings.TrimLeft(text[i+1:], " \t\r"), "\n") {
+					i = strings.IndexByte(text[i:], '\n') + i + 1
+					line++
+					continue
+				}
+				i++
+			}
+		case strings.HasPrefix(text[i:], "//"):
+			token.kind = formatComment
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			token.kind = formatComment
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, errorf(line, "unterminated comment")
+			}
+			i += end + 4
+			line += strings.Count(text[start:i], "\n")
+		case c == '"' || c == '\'':
+			token.kind = formatString
+			i++
+			for {
+				if i >= len(text) || text[i] == '\n' {
+					return nil, errorf(line, "unterminated string")
+				}
+				if text[i] == c {
+					if i+1 < len(text) && text[i+1] == c {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+		case strings.HasPrefix(text[i:], "+="):
+			token.kind = formatPunct
+			i += 2
+		case strings.IndexByte(formatPunctuation, c) >= 0:
+			token.kind = formatPunct
+			i++
+		default:
+			token.kind = formatWord
+			for i < len(text) && !strings.ContainsRune(" \t\r\n"+formatPunctuation, rune(text[i])) &&
+				!strings.HasPrefix(text[i:], "+=") && !strings.HasPrefix(text[i:], "//") && !strings.HasPrefix(text[i:], "/*") {
+				i++
+			}
+		}
+
+		token.text = strings.ReplaceAll(strings.TrimRight(text[start:i], " \t\r"), "\r\n", "\n")
+		tokens = append(tokens, token)
+		newlines = 0
+		space = ""
+	}
+	return tokens, nil
+}
+
+// configFormatter writes formatted configs. A class body is a list of
+// statements, comments and directives. A statement is written on one line,
+// except for arrays which are too long or contain comments, and classes
+// with entries, whose braces are written on their own lines.
+type configFormatter struct {
+	file   string
+	tokens []formatToken
+	pos    int
+	out    strings.Builder
+	blank  bool
+}
+
+func (f *configFormatter) errorf(format string, args ...any) error {
+	line := 0
+	if f.pos < len(f.tokens) {
+		line = f.tokens[f.pos].line
+	} else if len(f.tokens) > 0 {
+		line = f.tokens[len(f.tokens)-1].line
+	}
+	return &ConfigError{Pos: ConfigPos{File: f.file, Line: line}, Err: fmt.Sprintf(format, args...)}
+}
+
+func (f *configFormatter) peek() *formatToken {
+	if f.pos >= len(f.tokens) {
+		return nil
+	}
+	return &f.tokens[f.pos]
+}
+
+func (f *configFormatter) is(text string) bool {
+	token := f.peek()
+	return token != nil && token.kind == formatPunct && token.text == text
+}
+
+// line writes a line at depth, after a blank line if one is pending.
+func (f *configFormatter) line(depth int, text string) {
+	if f.blank {
+		f.out.WriteString("\n")
+		f.blank = false
+	}
+	f.out.WriteString(strings.Repeat("\t", depth) + text + "\n")
+}
+
+// trailingComments returns the comments following the previous token on
+// the same line, each preceded by a space.
+func (f *configFormatter) trailingComments() string {
+	var s string
+	for token := f.peek(); token != nil && token.kind == formatComment && !token.newline; token = f.peek() {
+		s += " " + token.text
+		f.pos++
+	}
+	return s
+}
+
+// body formats the entries of a class, up to its closing brace if closing.
+func (f *configFormatter) body(depth int, closing bool) error {
+	first := true
+	for {
+		token := f.peek()
+		if token == nil {
+			if closing {
+				return f.errorf("expected '}', found end of file")
+			}
+			return nil
+		}
+		if token.kind == formatPunct && token.text == "}" {
+			if !closing {
+				return f.errorf("unexpected '}'")
+			}
+			f.blank = false
+			return nil
+		}
+		f.blank = token.blank && !first
+		first = false
+
+		switch token.kind {
+		case formatDirective:
+			f.pos++
+			if f.blank {
+				f.out.WriteString("\n")
+				f.blank = false
+			}
+			f.out.WriteString(token.text + "\n")
+		case formatComment:
+			f.pos++
+			f.line(depth, token.text)
+		default:
+			err := f.statement(depth)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// statement formats an entry: a value, an array, a class or enum with its
+// body, or a macro on a line of its own.
+func (f *configFormatter) statement(depth int) error {
+	var head []formatToken
+	var comments string
+	parens := 0
+	for {
+		token := f.peek()
+		if parens == 0 && isBareStatement(head) && (token == nil || token.newline && !continuesStatement(token) || token.kind == formatPunct && token.text == "}") {
+			f.line(depth, formatHead(head)+comments)
+			return nil
+		}
+		if token == nil {
+			return f.errorf("expected ';', found end of file")
+		}
+
+		switch {
+		case token.kind == formatComment:
+			f.pos++
+			comments += " " + token.text
+			continue
+		case token.kind == formatDirective:
+			return f.errorf("preprocessor directive inside an entry is not supported")
+		case token.kind != formatPunct:
+		case token.text == "(":
+			parens++
+		case token.text == ")":
+			parens--
+		case parens > 0:
+		case token.text == ";" && len(head) == 0:
+			// stray semicolon
+			f.pos++
+			return nil
+		case token.text == ";":
+			f.pos++
+			f.line(depth, formatHead(head)+";"+comments+f.trailingComments())
+			return nil
+		case token.text == "}":
+			return f.errorf("expected ';', found '}'")
+		case token.text == "{" && len(head) > 0 && (head[len(head)-1].text == "=" || head[len(head)-1].text == "+="):
+			return f.arrayStatement(depth, head, comments)
+		case token.text == "{" && len(head) == 0:
+			return f.errorf("unexpected '{'")
+		case token.text == "{":
+			return f.classStatement(depth, head, comments)
+		}
+		head = append(head, *token)
+		f.pos++
+	}
+}
+
+// isBareStatement reports whether head may be an entry which is not
+// terminated by a semicolon, such as a macro call on a line of its own.
+func isBareStatement(head []formatToken) bool {
+	if len(head) == 0 {
+		return false
+	}
+	switch strings.ToLower(head[0].text) {
+	case "class", "delete", "enum":
+		return false
+	}
+	for _, token := range head {
+		if token.kind == formatPunct && (token.text == "=" || token.text == "+=") {
+			return false
+		}
+	}
+	return true
+}
+
+// continuesStatement reports whether token continues the entry before it
+// when it starts a line.
+func continuesStatement(token *formatToken) bool {
+	return token.kind == formatPunct && strings.Contains("=+=[]:{;", token.text)
+}
+
+func (f *configFormatter) classStatement(depth int, head []formatToken, comments string) error {
+	f.pos++ // {
+	isEnum := len(head) == 1 && strings.EqualFold(head[0].text, "enum")
+	if f.is("}") && !isEnum {
+		f.pos++
+		if f.is(";") {
+			f.pos++
+		}
+		f.line(depth, formatHead(head)+" {};"+comments+f.trailingComments())
+		return nil
+	}
+
+	f.line(depth, formatHead(head)+comments)
+	f.line(depth, "{"+f.trailingComments())
+	if isEnum {
+		array, err := f.array()
+		if err != nil {
+			return err
+		}
+		f.writeElements(depth+1, array)
+	} else {
+		err := f.body(depth+1, true)
+		if err != nil {
+			return err
+		}
+		f.pos++ // }
+	}
+	if f.is(";") {
+		f.pos++
+	}
+	f.line(depth, "};"+f.trailingComments())
+	return nil
+}
+
+func (f *configFormatter) arrayStatement(depth int, head []formatToken, comments string) error {
+	f.pos++ // {
+	array, err := f.array()
+	if err != nil {
+		return err
+	}
+	var tail []formatToken
+	for !f.is(";") {
+		token := f.peek()
+		if token == nil || token.kind == formatComment || token.kind == formatDirective || (token.kind == formatPunct && token.text != ")" && token.text != "(") {
+			return f.errorf("expected ';' after array")
+		}
+		tail = append(tail, *token)
+		f.pos++
+	}
+	f.pos++ // ;
+	end := joinTokens(tail) + ";"
+	comments += f.trailingComments()
+
+	line := formatHead(head) + " " + array.inline() + end
+	if !array.multiline(depth, len(line)) {
+		f.line(depth, line+comments)
+		return nil
+	}
+	f.line(depth, formatHead(head)+comments)
+	f.line(depth, "{")
+	f.writeElements(depth+1, array)
+	f.line(depth, "}"+end)
+	return nil
+}
+
+// formatArray is an array value, or the body of an enum.
+type formatArray struct {
+	elements []formatElement
+	comments []string // comments after the last element
+	newlines bool     // the array spans several lines
+}
+
+// formatElement is an array element, either a value or a nested array,
+// with the comments before and after it.
+type formatElement struct {
+	value    string
+	array    *formatArray
+	before   []string
+	trailing string
+}
+
+// array parses the elements of an array, up to and including its closing
+// brace.
+func (f *configFormatter) array() (*formatArray, error) {
+	array := &formatArray{}
+	var before []string
+	for {
+		token := f.peek()
+		if token == nil {
+			return nil, f.errorf("expected '}', found end of file")
+		}
+		if token.newline {
+			array.newlines = true
+		}
+
+		switch {
+		case token.kind == formatComment:
+			f.pos++
+			if !token.newline && len(array.elements) > 0 {
+				array.elements[len(array.elements)-1].trailing += " " + token.text
+			} else {
+				before = append(before, token.text)
+			}
+			continue
+		case token.kind == formatDirective:
+			return nil, f.errorf("preprocessor directive inside an array is not supported")
+		case token.kind == formatPunct && token.text == "}":
+			f.pos++
+			array.comments = before
+			return array, nil
+		}
+
+		element := formatElement{before: before}
+		before = nil
+		if token.kind == formatPunct && token.text == "{" {
+			f.pos++
+			nested, err := f.array()
+			if err != nil {
+				return nil, err
+			}
+			element.array = nested
+		} else {
+			var value []formatToken
+			parens := 0
+			for token := f.peek(); token != nil; token = f.peek() {
+				if token.kind == formatComment || token.kind == formatDirective {
+					break
+				}
+				if token.kind == formatPunct {
+					if parens == 0 && (token.text == "," || token.text == "}") {
+						break
+					}
+					switch token.text {
+					case "(":
+						parens++
+					case ")":
+						parens--
+					case ";", "{":
+						if parens == 0 {
+							return nil, f.errorf("expected ',' or '}' in array, found '%s'", token.text)
+						}
+					}
+				}
+				if len(value) > 0 && token.newline {
+					array.newlines = true
+				}
+				value = append(value, *token)
+				f.pos++
+			}
+			if len(value) == 0 {
+				return nil, f.errorf("expected array element")
+			}
+			element.value = joinTokens(value)
+			for _, token := range value {
+				if token.kind == formatPunct && token.text == "=" {
+					// enum constant
+					element.value = formatHead(value)
+				}
+			}
+		}
+		array.elements = append(array.elements, element)
+
+		if f.is(",") {
+			f.pos++
+		}
+	}
+}
+
+// inline returns the array on one line.
+func (a *formatArray) inline() string {
+	values := []string{}
+	for _, element := range a.elements {
+		if element.array != nil {
+			values = append(values, element.array.inline())
+		} else {
+			values = append(values, element.value)
+		}
+	}
+	return "{" + strings.Join(values, ", ") + "}"
+}
+
+// multiline reports whether the array is written one element per line: it
+// contains comments, it was written over several lines with more than one
+// element, or it is too long for a line of length at depth.
+func (a *formatArray) multiline(depth, length int) bool {
+	if depth*4+length > maxArrayLineLength || len(a.comments) > 0 || (a.newlines && len(a.elements) > 1) {
+		return true
+	}
+	for _, element := range a.elements {
+		if len(element.before) > 0 || element.trailing != "" {
+			return true
+		}
+		if element.array != nil && element.array.multiline(depth+1, len(element.array.inline())) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeElements writes the elements of an array one per line.
+func (f *configFormatter) writeElements(depth int, array *formatArray) {
+	for i, element := range array.elements {
+		for _, comment := range element.before {
+			f.line(depth, comment)
+		}
+		comma := ","
+		if i == len(array.elements)-1 {
+			comma = ""
+		}
+		if element.array == nil {
+			f.line(depth, element.value+comma+element.trailing)
+			continue
+		}
+		inline := element.array.inline()
+		if !element.array.multiline(depth, len(inline)+len(comma)) {
+			f.line(depth, inline+comma+element.trailing)
+			continue
+		}
+		f.line(depth, "{")
+		f.writeElements(depth+1, element.array)
+		f.line(depth, "}"+comma+element.trailing)
+	}
+	for _, comment := range array.comments {
+		f.line(depth, comment)
+	}
+}
+
+// formatHead formats the tokens of an entry before its value or body, with
+// canonical spacing around =, :, [] and commas. The value after = keeps its
+// spacing, as unquoted values are used as written.
+func formatHead(tokens []formatToken) string {
+	for i, token := range tokens {
+		if token.kind == formatPunct && (token.text == "=" || token.text == "+=") {
+			head := formatHead(tokens[:i]) + " " + token.text
+			if value := joinTokens(tokens[i+1:]); value != "" {
+				head += " " + value
+			}
+			return head
+		}
+	}
+
+	var s strings.Builder
+	parens := 0
+	for i, token := range tokens {
+		switch {
+		case i == 0:
+		case parens > 0 || token.text == ")":
+			s.WriteString(token.space)
+		case token.kind == formatPunct && strings.Contains(":[](,", token.text):
+		case tokens[i-1].text == "[" || tokens[i-1].text == "(":
+		default:
+			s.WriteString(" ")
+		}
+		if token.kind == formatPunct {
+			switch token.text {
+			case "(":
+				parens++
+			case ")":
+				parens--
+			}
+		}
+		s.WriteString(token.text)
+	}
+	return s.String()
+}
+
+// joinTokens joins tokens with the whitespace written between them, or a
+// space where they were on different lines.
+func joinTokens(tokens []formatToken) string {
+	var s strings.Builder
+	for i, token := range tokens {
+		if i > 0 {
+			if token.newline {
+				s.WriteString(" ")
+			} else {
+				s.WriteString(token.space)
+			}
+		}
+		s.WriteString(token.text)
+	}
+	return s.String()
+}
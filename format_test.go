@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "classes",
+			input:    "class A{x=1;class B:A{};class C : B {y = \"a\";};};",
+			expected: "class A\n{\n\tx = 1;\n\tclass B: A {};\n\tclass C: B\n\t{\n\t\ty = \"a\";\n\t};\n};\n",
+		},
+		{
+			name:     "external classes and delete",
+			input:    "class A ;\ndelete  B;\n",
+			expected: "class A;\ndelete B;\n",
+		},
+		{
+			name:     "indentation",
+			input:    "class A\n{\n        class B\n    {\n  x = 1;\n    };\n};\n",
+			expected: "class A\n{\n\tclass B\n\t{\n\t\tx = 1;\n\t};\n};\n",
+		},
+		{
+			name:     "unquoted values keep their spacing",
+			input:    "a=\\dz\\gear\\x.p3d;\nb  =  some  text ;\n",
+			expected: "a = \\dz\\gear\\x.p3d;\nb = some  text;\n",
+		},
+		{
+			name:     "arrays",
+			input:    "a[]={1,2,3};\nb[]+={\"x\"};\nc[]={{1,2},{}};\nd[] = {};\n",
+			expected: "a[] = {1, 2, 3};\nb[] += {\"x\"};\nc[] = {{1, 2}, {}};\nd[] = {};\n",
+		},
+		{
+			name:     "multi-line arrays",
+			input:    "a[] = {\n\t\"x\",\n\t\"y\"};\nb[] = {\n\t\"x\"\n};\n",
+			expected: "a[] =\n{\n\t\"x\",\n\t\"y\"\n};\nb[] = {\"x\"};\n",
+		},
+		{
+			name:  "long arrays",
+			input: `textures[] = {"WILDLANDZ\Anniversary\gear\food\data\cupcake_co.paa", "WILDLANDZ\Anniversary\gear\food\data\cake_co.paa"};`,
+			expected: "textures[] =\n{\n" +
+				"\t\"WILDLANDZ\\Anniversary\\gear\\food\\data\\cupcake_co.paa\",\n" +
+				"\t\"WILDLANDZ\\Anniversary\\gear\\food\\data\\cake_co.paa\"\n};\n",
+		},
+		{
+			name:     "nested multi-line arrays",
+			input:    "a[] = {\n\t{1, 2},\n\t{ // three\n\t\t3\n\t}\n};\n",
+			expected: "a[] =\n{\n\t{1, 2},\n\t{\n\t\t// three\n\t\t3\n\t}\n};\n",
+		},
+		{
+			name:     "comments",
+			input:    "// header\nclass A // base\n{ // body\n\tx = 1; // one\n\t/* two\n\t   lines */\n\ty[] = {1, // first\n\t\t2};\n};\n",
+			expected: "// header\nclass A // base\n{ // body\n\tx = 1; // one\n\t/* two\n\t   lines */\n\ty[] =\n\t{\n\t\t1, // first\n\t\t2\n\t};\n};\n",
+		},
+		{
+			name:     "blank lines",
+			input:    "\n\nclass A\n{\n\n\tx = 1;\n\n\n\ty = 2;\n\n};\n\n\nclass B {};\n\n",
+			expected: "class A\n{\n\tx = 1;\n\n\ty = 2;\n};\n\nclass B {};\n",
+		},
+		{
+			name:     "preprocessor directives and macros",
+			input:    "#include \"macros.hpp\"\n#define ITEM(name) class name: Item {}\nclass CfgVehicles {\n  #ifdef DEBUG\n  ITEM(Foo);\n  #endif\n  ITEM( Bar )\n  MACRO\n  class A: B {};\n};\n",
+			expected: "#include \"macros.hpp\"\n#define ITEM(name) class name: Item {}\nclass CfgVehicles\n{\n#ifdef DEBUG\n\tITEM(Foo);\n#endif\n\tITEM( Bar )\n\tMACRO\n\tclass A: B {};\n};\n",
+		},
+		{
+			name:     "directive continuation lines",
+			input:    "#define A(x) \\\n  x = 1;\nclass B {};\n",
+			expected: "#define A(x) \\\n  x = 1;\nclass B {};\n",
+		},
+		{
+			name:     "enums",
+			input:    "enum {A,B=2};",
+			expected: "enum\n{\n\tA,\n\tB = 2\n};\n",
+		},
+		{
+			name:     "windows line endings",
+			input:    "class A{x=1;};\r\n",
+			expected: "class A\r\n{\r\n\tx = 1;\r\n};\r\n",
+		},
+		{
+			name:     "byte order mark",
+			input:    "\ufeffclass A {};",
+			expected: "\ufeffclass A {};\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := FormatConfig("config.cpp", []byte(test.input))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(formatted))
+
+			again, err := FormatConfig("config.cpp", formatted)
+			require.NoError(t, err)
+			assert.Equal(t, string(formatted), string(again), "formatting is not idempotent")
+		})
+	}
+}
+
+func TestFormatConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"unterminated string", "a = \"x;\n", "config.cpp:1: unterminated string"},
+		{"unterminated comment", "class A {};\n/* x", "config.cpp:2: unterminated comment"},
+		{"missing brace", "class A {\n\tx = 1;\n", "config.cpp:2: expected '}', found end of file"},
+		{"extra brace", "class A {};\n};\n", "config.cpp:2: unexpected '}'"},
+		{"missing semicolon", "class A {\n\tx = 1\n};\n", "config.cpp:3: expected ';', found '}'"},
+		{"directive in array", "a[] = {\n#ifdef X\n1\n#endif\n};\n", "config.cpp:2: preprocessor directive inside an array is not supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := FormatConfig("config.cpp", []byte(test.input))
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestSameTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		same   bool
+	}{
+		{"whitespace", "class A{x=1;};", "class A\n{\n\tx = 1;\n};\n", true},
+		{"comments", "x = 1; // one\n", "/* one */ x = 1;\n", true},
+		{"added and stray semicolons", "class A {};;\nclass B {}\n", "class A {};\nclass B {};\n", true},
+		{"trailing commas", "a[] = {1, 2,};\n", "a[] = {1, 2};\n", true},
+		{"macro arguments", "#include \"x.hpp\"\nITEM(a, b)\n", "#include \"x.hpp\"\nITEM(a b)\n", false},
+		{"changed value", "x = 1;\n", "x = 2;\n", false},
+		{"directive", "#define A 1\n", "#define A 2\n", false},
+		{"missing semicolon", "x = 1;\ny = 2;\n", "x = 1\ny = 2;\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before, err := formatTokens("config.cpp", test.before)
+			require.NoError(t, err)
+			after, err := formatTokens("config.cpp", test.after)
+			require.NoError(t, err)
+			assert.Equal(t, test.same, sameTokens(before, after))
+		})
+	}
+}
+
+func TestFormatFiles(t *testing.T) {
+	root := testFiles(t, map[string]string{
+		"config.cpp":             "class A {};\n",
+		"gear/food/config.cpp":   "class B{x=1;};",
+		"gear/food/macros.hpp":   "#define X 1\nclass C{};",
+		"gear/food/readme.txt":   "class D{};",
+		"gear/food/model.cfg":    "class E{};",
+		"gear/drinks/Config.cpp": "class F {};\n",
+	})
+
+	err := formatFiles([]string{root}, true)
+	assert.EqualError(t, err, "found 2 unformatted files")
+
+	require.NoError(t, formatFiles([]string{root}, false))
+	require.NoError(t, formatFiles([]string{root}, true))
+
+	data, err := os.ReadFile(filepath.Join(root, "gear", "food", "config.cpp"))
+	require.NoError(t, err)
+	assert.Equal(t, "class B\n{\n\tx = 1;\n};\n", string(data))
+	data, err = os.ReadFile(filepath.Join(root, "gear", "food", "readme.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "class D{};", string(data))
+}
@@ -5,20 +5,42 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"golang.org/x/term"
 )
 
+// stdin is shared by the prompts, so input buffered by one is not lost to
+// the next.
+var stdin = bufio.NewReader(os.Stdin)
+
 func yesOrNo(override bool, prompt string) (bool, error) {
 	if override {
 		fmt.Print(prompt)
 		fmt.Println("Y (override)")
 		return true, nil
 	}
-	reader := bufio.NewReader(os.Stdin)
 	fmt.Print(prompt)
-	text, err := reader.ReadString('\n')
+	text, err := stdin.ReadString('\n')
 	if err != nil {
 		return false, err
 	}
 	trimmed := strings.ToLower(strings.TrimSpace(text))
 	return trimmed == "y" || trimmed == "yes", nil
 }
+
+// readPassphrase prompts for a passphrase on the terminal, without echoing
+// it. Without a terminal the passphrase can't be hidden, so it is an error.
+func readPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("can't prompt for the passphrase without a terminal, use -passphrase-file or $%s", passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the passphrase without echo: %w, use -passphrase-file or $%s", err, passphraseEnv)
+	}
+	return passphrase, nil
+}
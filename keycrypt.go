@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// encryptedKeyMagic starts an encrypted .biprivatekey, which is otherwise
+// read as a plain one.
+const encryptedKeyMagic = "MBENCKEY"
+
+const (
+	encryptedKeyVersion    = 1
+	encryptedKeyIterations = 600000
+	encryptedKeySaltSize   = 16
+)
+
+// passphraseEnv is the environment variable which holds the passphrase of
+// an encrypted key, for builds without a terminal.
+const passphraseEnv = "MOD_BUILD_KEY_PASSPHRASE"
+
+// isEncryptedKey reports whether data is an encrypted .biprivatekey.
+func isEncryptedKey(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedKeyMagic))
+}
+
+// EncryptBIPrivateKey returns key as an encrypted .biprivatekey: a header
+// with the PBKDF2 parameters, followed by the plain .biprivatekey sealed
+// with AES-256-GCM under the key derived from passphrase.
+func EncryptBIPrivateKey(key *BIPrivateKey, passphrase []byte) ([]byte, error) {
+	var plain bytes.Buffer
+	err := EncodeBIPrivateKey(&plain, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.WriteString(encryptedKeyMagic)
+	header.WriteByte(encryptedKeyVersion)
+	_ = binary.Write(&header, binary.LittleEndian, uint32(encryptedKeyIterations))
+	salt := make([]byte, encryptedKeySaltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	header.Write(salt)
+
+	aead, err := keyCipher(passphrase, salt, encryptedKeyIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	header.Write(nonce)
+
+	return aead.Seal(header.Bytes(), nonce, plain.Bytes(), header.Bytes()), nil
+}
+
+// DecryptBIPrivateKey reads an encrypted .biprivatekey.
+func DecryptBIPrivateKey(data, passphrase []byte) (*BIPrivateKey, error) {
+	headerSize := len(encryptedKeyMagic) + 1 + 4 + encryptedKeySaltSize
+	if !isEncryptedKey(data) || len(data) < headerSize {
+		return nil, errors.New("not an encrypted key")
+	}
+	if version := data[len(encryptedKeyMagic)]; version != encryptedKeyVersion {
+		return nil, fmt.Errorf("unsupported encrypted key version %d", version)
+	}
+	// version 1 keys are always written with the same count, so any other
+	// count is corruption, and would otherwise let a crafted key make the
+	// key derivation take practically forever
+	iterations := int(binary.LittleEndian.Uint32(data[len(encryptedKeyMagic)+1:]))
+	if iterations != encryptedKeyIterations {
+		return nil, fmt.Errorf("unsupported iteration count %d in encrypted key version %d, expected %d", iterations, encryptedKeyVersion, encryptedKeyIterations)
+	}
+	salt := data[headerSize-encryptedKeySaltSize : headerSize]
+
+	aead, err := keyCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize+aead.NonceSize() {
+		return nil, errors.New("truncated encrypted key")
+	}
+	headerSize += aead.NonceSize()
+	plain, err := aead.Open(nil, data[headerSize-aead.NonceSize():headerSize], data[headerSize:], data[:headerSize])
+	if err != nil {
+		return nil, errors.New("wrong passphrase, or the key is corrupted")
+	}
+	return DecodeBIPrivateKey(bytes.NewReader(plain))
+}
+
+func keyCipher(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// passphraseSource reads the passphrase of an encrypted key from a file if
+// one is set, otherwise from the environment, otherwise from a prompt.
+type passphraseSource struct {
+	file string
+}
+
+func (s *passphraseSource) register(flags *flag.FlagSet) {
+	flags.StringVar(&s.file, "passphrase-file", "", "File to read the passphrase of an encrypted private key from (defaults to $"+passphraseEnv+", or a prompt)")
+}
+
+// Read returns the passphrase for the key at path. When confirm is set, as
+// for a new passphrase, a prompted passphrase is asked for twice to catch
+// typos.
+func (s passphraseSource) Read(path string, confirm bool) ([]byte, error) {
+	var passphrase []byte
+	switch {
+	case s.file != "":
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, err
+		}
+		passphrase = []byte(strings.TrimRight(string(data), "\r\n"))
+	case os.Getenv(passphraseEnv) != "":
+		passphrase = []byte(os.Getenv(passphraseEnv))
+	default:
+		var err error
+		passphrase, err = readPassphrase(fmt.Sprintf("🔒 Passphrase for %q: ", path))
+		if err != nil {
+			return nil, err
+		}
+		if confirm {
+			again, err := readPassphrase("🔒 Repeat the passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(passphrase, again) {
+				return nil, errors.New("error: the passphrases do not match")
+			}
+		}
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("error: the passphrase is empty")
+	}
+	return passphrase, nil
+}
+
+// readBIPrivateKeyFile reads the .biprivatekey at path, decrypting it with
+// the passphrase from passphrase if it is encrypted.
+func readBIPrivateKeyFile(path string, passphrase passphraseSource) (*BIPrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *BIPrivateKey
+	if isEncryptedKey(data) {
+		var secret []byte
+		secret, err = passphrase.Read(path, false)
+		if err != nil {
+			return nil, err
+		}
+		key, err = DecryptBIPrivateKey(data, secret)
+	} else {
+		key, err = DecodeBIPrivateKey(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", path, err)
+	}
+	return key, nil
+}
+
+func newEncryptKeyCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build encrypt-key", flag.ExitOnError)
+	decrypt := flags.Bool("decrypt", false, "Decrypt the key instead, for tools which need the plain key")
+	var passphrase passphraseSource
+	passphrase.register(flags)
+
+	return &ffcli.Command{
+		Name:       "encrypt-key",
+		ShortUsage: "mod-build encrypt-key [options] <key.biprivatekey>",
+		ShortHelp:  "Encrypt a private key with a passphrase",
+		LongHelp: "Encrypt a .biprivatekey in place with a passphrase, so it is safe to keep at\n" +
+			"rest. Encrypted keys are decrypted in memory when signing, with the passphrase\n" +
+			"from -passphrase-file, $" + passphraseEnv + " or a prompt.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				fmt.Fprintln(os.Stderr, "error: private key is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return encryptKeyFile(args[0], *decrypt, passphrase)
+		},
+	}
+}
+
+func encryptKeyFile(path string, decrypt bool, passphrase passphraseSource) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isEncryptedKey(data) != decrypt {
+		if decrypt {
+			return fmt.Errorf("error: %q is not encrypted", path)
+		}
+		return fmt.Errorf("error: %q is already encrypted", path)
+	}
+
+	key, err := readBIPrivateKeyFile(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	if decrypt {
+		fmt.Printf("🔓 Decrypting : %q\n", path)
+		var buf bytes.Buffer
+		err = EncodeBIPrivateKey(&buf, key)
+		out = buf.Bytes()
+	} else {
+		var secret []byte
+		secret, err = passphrase.Read(path, true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🔒 Encrypting : %q\n", path)
+		out, err = EncryptBIPrivateKey(key, secret)
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	_ = os.Remove(tmp)
+	err = writeKeyFile(tmp, 0600, func(w io.Writer) error {
+		_, err := w.Write(out)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
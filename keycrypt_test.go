@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptBIPrivateKey(t *testing.T) {
+	key, err := GenerateBIKey("WLZ")
+	require.NoError(t, err)
+
+	data, err := EncryptBIPrivateKey(key, []byte("hunter2"))
+	require.NoError(t, err)
+	assert.True(t, isEncryptedKey(data))
+	assert.NotContains(t, string(data), "RSA2")
+
+	decrypted, err := DecryptBIPrivateKey(data, []byte("hunter2"))
+	require.NoError(t, err)
+	assert.Equal(t, "WLZ", decrypted.Authority)
+	assert.True(t, key.Key.Equal(decrypted.Key))
+
+	_, err = DecryptBIPrivateKey(data, []byte("hunter3"))
+	assert.ErrorContains(t, err, "wrong passphrase")
+
+	tampered := append([]byte{}, data...)
+	tampered[len(encryptedKeyMagic)+5] ^= 1
+	_, err = DecryptBIPrivateKey(tampered, []byte("hunter2"))
+	assert.Error(t, err)
+
+	_, err = DecryptBIPrivateKey(data[:20], []byte("hunter2"))
+	assert.Error(t, err)
+
+	iterations := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(iterations[len(encryptedKeyMagic)+1:], math.MaxUint32)
+	_, err = DecryptBIPrivateKey(iterations, []byte("hunter2"))
+	assert.ErrorContains(t, err, "unsupported iteration count 4294967295")
+}
+
+func TestReadBIPrivateKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, keygen("WLZ", dir, []byte("hunter2")))
+	path := filepath.Join(dir, "WLZ.biprivatekey")
+	passphraseFile := filepath.Join(dir, "passphrase.txt")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("hunter2\r\n"), 0600))
+
+	t.Run("passphrase file", func(t *testing.T) {
+		key, err := readBIPrivateKeyFile(path, passphraseSource{file: passphraseFile})
+		require.NoError(t, err)
+		assert.Equal(t, "WLZ", key.Authority)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv(passphraseEnv, "hunter2")
+		_, err := readBIPrivateKeyFile(path, passphraseSource{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("passphrase file before environment", func(t *testing.T) {
+		t.Setenv(passphraseEnv, "wrong")
+		_, err := readBIPrivateKeyFile(path, passphraseSource{file: passphraseFile})
+		assert.NoError(t, err)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		t.Setenv(passphraseEnv, "wrong")
+		_, err := readBIPrivateKeyFile(path, passphraseSource{})
+		assert.ErrorContains(t, err, "wrong passphrase")
+	})
+}
+
+func TestEncryptKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, keygen("WLZ", dir, nil))
+	path := filepath.Join(dir, "WLZ.biprivatekey")
+	plain, err := os.ReadFile(path)
+	require.NoError(t, err)
+	t.Setenv(passphraseEnv, "hunter2")
+
+	require.NoError(t, encryptKeyFile(path, false, passphraseSource{}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, isEncryptedKey(data))
+	assert.ErrorContains(t, encryptKeyFile(path, false, passphraseSource{}), "already encrypted")
+
+	require.NoError(t, encryptKeyFile(path, true, passphraseSource{}))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, plain, data)
+	assert.ErrorContains(t, encryptKeyFile(path, true, passphraseSource{}), "not encrypted")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
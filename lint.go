@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// defaultKnownAddons are the CfgPatches classes of the vanilla game which
+// addons commonly require. More can be added with -known-addon.
+var defaultKnownAddons = []string{
+	"DZ_AI",
+	"DZ_Animals",
+	"DZ_Characters",
+	"DZ_Characters_Backpacks",
+	"DZ_Characters_Belts",
+	"DZ_Characters_Glasses",
+	"DZ_Characters_Gloves",
+	"DZ_Characters_Headgear",
+	"DZ_Characters_Masks",
+	"DZ_Characters_Pants",
+	"DZ_Characters_Shoes",
+	"DZ_Characters_Tops",
+	"DZ_Characters_Vests",
+	"DZ_Characters_Zombies",
+	"DZ_Data",
+	"DZ_Gear_Books",
+	"DZ_Gear_Camping",
+	"DZ_Gear_Consumables",
+	"DZ_Gear_Containers",
+	"DZ_Gear_Cooking",
+	"DZ_Gear_Crafting",
+	"DZ_Gear_Cultivation",
+	"DZ_Gear_Drinks",
+	"DZ_Gear_Food",
+	"DZ_Gear_Medical",
+	"DZ_Gear_Navigation",
+	"DZ_Gear_Optics",
+	"DZ_Gear_Radio",
+	"DZ_Gear_Tools",
+	"DZ_Gear_Traps",
+	"DZ_Scripts",
+	"DZ_Sounds_Effects",
+	"DZ_Sounds_Weapons",
+	"DZ_Structures",
+	"DZ_Structures_Military",
+	"DZ_Structures_Residential",
+	"DZ_Surfaces",
+	"DZ_Vehicles_Parts",
+	"DZ_Vehicles_Wheeled",
+	"DZ_Weapons_Ammunition",
+	"DZ_Weapons_Explosives",
+	"DZ_Weapons_Firearms",
+	"DZ_Weapons_Lights",
+	"DZ_Weapons_Magazines",
+	"DZ_Weapons_Melee",
+	"DZ_Weapons_Muzzles",
+	"DZ_Weapons_Optics",
+	"DZ_Weapons_Pistols",
+	"DZ_Weapons_Projectiles",
+	"DZ_Weapons_Supports",
+	"DZ_Worlds_Chernarusplus_World",
+	"DZ_Worlds_Enoch",
+}
+
+// patchesArrays maps the CfgPatches arrays which list classes of the addon
+// to the config class the listed classes are defined in.
+var patchesArrays = []struct {
+	Name  string
+	Class string
+}{
+	{"units", "CfgVehicles"},
+	{"weapons", "CfgWeapons"},
+}
+
+// KnownAddons is a list of addon names which may be required without being
+// part of the workspace. Names may contain * and ? wildcards, and are
+// matched case-insensitively.
+type KnownAddons []string
+
+func (k *KnownAddons) String() string {
+	if k == nil {
+		return ""
+	}
+	return strings.Join(*k, ",")
+}
+
+func (k *KnownAddons) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return fmt.Errorf("invalid addon pattern %q: %w", name, err)
+		}
+		*k = append(*k, name)
+	}
+	return nil
+}
+
+// Match reports whether name matches one of the known addons.
+func (k KnownAddons) Match(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range k {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type lintOptions struct {
+	knownAddons KnownAddons
+	workspace   string
+}
+
+func (o *lintOptions) register(flags *flag.FlagSet) {
+	flags.Var(&o.knownAddons, "known-addon", "Addon which may be listed in requiredAddons in addition to the vanilla DZ_* addons, may be repeated or comma separated and contain * wildcards")
+	flags.StringVar(&o.workspace, "workspace", "", "Directory containing other addons whose CfgPatches may be listed in requiredAddons (optional)")
+}
+
+func newLintCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build lint", flag.ExitOnError)
+	var opts lintOptions
+	opts.register(flags)
+
+	return &ffcli.Command{
+		Name:       "lint",
+		ShortUsage: "mod-build lint [options] <source-directory>",
+		ShortHelp:  "Check the configs of an addon for mistakes",
+		LongHelp: "Check the config.cpp files of an addon for mistakes which would otherwise only\n" +
+			"show up when the game starts, such as undefined base classes, classes defined\n" +
+			"twice, a missing CfgPatches class, units or weapons which are not defined in\n" +
+			"the addon, and unknown requiredAddons.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				fmt.Fprintln(os.Stderr, "error: source directory is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+
+			source := NewSource(args[0])
+			err := source.EnsureValid()
+			if err != nil {
+				return err
+			}
+			prefix, err := source.Prefix()
+			if err != nil {
+				return err
+			}
+			task, err := source.Prepare()
+			if err != nil {
+				return err
+			}
+
+			problems, err := lintAddon(args[0], prefix, task.Copy, opts)
+			if err != nil {
+				return err
+			}
+			if problems > 0 {
+				return fmt.Errorf("found %d problems in the configs", problems)
+			}
+			return nil
+		},
+	}
+}
+
+// lintAddon lints the configs among paths in the source directory, printing
+// the problems found, and returns how many there were.
+func lintAddon(sourceDir, prefix string, paths []string, opts lintOptions) (int, error) {
+	known := append(KnownAddons{}, defaultKnownAddons...)
+	known = append(known, opts.knownAddons...)
+	if opts.workspace != "" {
+		addons, err := workspaceAddons(opts.workspace)
+		if err != nil {
+			return 0, err
+		}
+		known = append(known, addons...)
+	}
+
+	preprocessor := NewPreprocessor(sourceDir, prefix)
+	var configs []*Config
+	var problems []string
+	for _, path := range paths {
+		if !isRapifiable(path) {
+			continue
+		}
+		fmt.Printf("🔍 Linting    : %q\n", path)
+		config, err := loadConfig(preprocessor, path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		configs = append(configs, config)
+	}
+	problems = append(problems, LintConfigs(configs, known)...)
+
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "❌ Lint       : %s\n", problem)
+	}
+	return len(problems), nil
+}
+
+// loadConfig preprocesses and parses the config at name.
+func loadConfig(preprocessor *Preprocessor, name string) (*Config, error) {
+	data, _, err := preprocessor.Preprocess(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(name, data)
+}
+
+// LintConfigs checks the configs of one addon and returns the problems
+// found, each prefixed with its position. Base classes must be declared
+// before they are inherited from, and a class may only be defined once in a
+// scope. Every config must declare its addon in CfgPatches, the units and
+// weapons it lists must be defined by the addon, and the addons it requires
+// must be defined by the addon or be known.
+func LintConfigs(configs []*Config, known KnownAddons) []string {
+	var problems []string
+	problemf := func(pos ConfigPos, format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, args...)))
+	}
+
+	for _, config := range configs {
+		lintClasses(&configScope{class: config.Root}, problemf)
+	}
+
+	// classes defined by the addon, by config class and lower case name
+	defined := map[string]map[string]bool{}
+	for _, array := range patchesArrays {
+		defined[array.Class] = map[string]bool{}
+	}
+	addons := map[string]bool{}
+	for _, config := range configs {
+		for _, array := range patchesArrays {
+			if class := findConfigClass(config.Root, array.Class); class != nil {
+				for _, entry := range class.Entries {
+					if entry.Kind == ConfigClassEntry {
+						defined[array.Class][strings.ToLower(entry.Name)] = true
+					}
+				}
+			}
+		}
+		for _, patch := range patchesClasses(config) {
+			addons[strings.ToLower(patch.Name)] = true
+		}
+	}
+
+	for _, config := range configs {
+		patches := findConfigClass(config.Root, "CfgPatches")
+		if patches == nil {
+			problemf(config.Root.Pos, "no CfgPatches class")
+			continue
+		}
+		if len(patchesClasses(config)) == 0 {
+			problemf(patches.Pos, "CfgPatches declares no addon")
+			continue
+		}
+
+		for _, patch := range patchesClasses(config) {
+			for _, array := range patchesArrays {
+				for _, entry := range findConfigArrays(patch, array.Name) {
+					for _, name := range configStrings(entry.Value) {
+						if !defined[array.Class][strings.ToLower(name)] {
+							problemf(entry.Pos, "%s.%s lists %q, which is not defined in %s", patch.Name, array.Name, name, array.Class)
+						}
+					}
+				}
+			}
+			for _, entry := range findConfigArrays(patch, "requiredAddons") {
+				for _, name := range configStrings(entry.Value) {
+					if !addons[strings.ToLower(name)] && !known.Match(name) {
+						problemf(entry.Pos, "%s.requiredAddons lists unknown addon %q", patch.Name, name)
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// configScope is a class whose entries are being linted. Only the first
+// count entries have been declared so far.
+type configScope struct {
+	class  *ConfigClass
+	parent *configScope
+	count  int
+}
+
+// lookup reports whether a class called name is visible from the scope: it
+// is declared in the scope or an enclosing one, or may be inherited by one
+// of them from a base class whose contents are not known.
+func (s *configScope) lookup(name string) (*ConfigEntry, bool) {
+	for scope := s; scope != nil; scope = scope.parent {
+		for i := scope.count - 1; i >= 0; i-- {
+			entry := scope.class.Entries[i]
+			if (entry.Kind == ConfigClassEntry || entry.Kind == ConfigExternEntry) && strings.EqualFold(entry.Name, name) {
+				return &entry, true
+			}
+		}
+
+		if scope.class.Base == "" || scope.parent == nil {
+			continue
+		}
+		base, ok := scope.parent.lookup(scope.class.Base)
+		if !ok {
+			// reported where the base class is inherited from
+			continue
+		}
+		if base == nil || base.Kind == ConfigExternEntry || base.Class.Base != "" {
+			// the members of the base class are not fully known
+			return nil, true
+		}
+		if class := findConfigClass(base.Class, name); class != nil {
+			return &ConfigEntry{Kind: ConfigClassEntry, Name: class.Name, Class: class, Pos: class.Pos}, true
+		}
+	}
+	return nil, false
+}
+
+// lintClasses checks that the classes in scope, and the classes nested in
+// them, inherit from declared classes and are not defined twice.
+func lintClasses(scope *configScope, problemf func(pos ConfigPos, format string, args ...any)) {
+	defined := map[string]ConfigPos{}
+	for i, entry := range scope.class.Entries {
+		scope.count = i
+		switch entry.Kind {
+		case ConfigClassEntry:
+			key := strings.ToLower(entry.Name)
+			if pos, ok := defined[key]; ok {
+				problemf(entry.Pos, "class %s is already defined at %s", entry.Name, pos)
+			}
+			defined[key] = entry.Pos
+
+			base := entry.Class.Base
+			if base != "" {
+				if _, ok := scope.lookup(base); !ok {
+					problemf(entry.Pos, "class %s inherits from undefined class %s (declare it with class %s;)", entry.Name, base, base)
+				}
+			}
+			lintClasses(&configScope{class: entry.Class, parent: scope}, problemf)
+		case ConfigDeleteEntry:
+			delete(defined, strings.ToLower(entry.Name))
+		}
+	}
+	scope.count = len(scope.class.Entries)
+}
+
+// workspaceAddons returns the addons declared in the CfgPatches of every
+// config.cpp or config.bin below dir. Configs which cannot be read are
+// skipped with a warning.
+func workspaceAddons(dir string) ([]string, error) {
+	preprocessor := NewPreprocessor(dir, "")
+	var addons []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		var config *Config
+		switch strings.ToLower(filepath.Base(path)) {
+		case "config.cpp":
+			config, err = loadConfig(preprocessor, path)
+		case "config.bin":
+			var data []byte
+			data, err = os.ReadFile(filepath.Join(dir, path))
+			if err == nil {
+				config, err = Derapify(data)
+			}
+		default:
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ Skipping workspace config %q: %s\n", path, err)
+			return nil
+		}
+
+		for _, patch := range patchesClasses(config) {
+			addons = append(addons, patch.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading workspace %q: %w", dir, err)
+	}
+	return addons, nil
+}
+
+// patchesClasses returns the addon classes declared in CfgPatches.
+func patchesClasses(config *Config) []*ConfigClass {
+	patches := findConfigClass(config.Root, "CfgPatches")
+	if patches == nil {
+		return nil
+	}
+	var classes []*ConfigClass
+	for _, entry := range patches.Entries {
+		if entry.Kind == ConfigClassEntry {
+			classes = append(classes, entry.Class)
+		}
+	}
+	return classes
+}
+
+// findConfigClass returns the class called name defined directly in class,
+// ignoring case as the game does.
+func findConfigClass(class *ConfigClass, name string) *ConfigClass {
+	for _, entry := range class.Entries {
+		if entry.Kind == ConfigClassEntry && strings.EqualFold(entry.Name, name) {
+			return entry.Class
+		}
+	}
+	return nil
+}
+
+// findConfigArrays returns the array entries, assigned or appended, called
+// name in class.
+func findConfigArrays(class *ConfigClass, name string) []ConfigEntry {
+	var entries []ConfigEntry
+	for _, entry := range class.Entries {
+		if (entry.Kind == ConfigArrayEntry || entry.Kind == ConfigAppendEntry) && strings.EqualFold(entry.Name, name) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// configStrings returns the string elements of an array value.
+func configStrings(array ConfigValue) []string {
+	var values []string
+	for _, value := range array.Array {
+		if value.Type == ConfigString {
+			values = append(values, value.String)
+		}
+	}
+	return values
+}
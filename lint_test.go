@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintConfigs(t *testing.T) {
+	tests := []struct {
+		name     string
+		configs  map[string]string
+		expected []string
+	}{
+		{
+			name: "valid",
+			configs: map[string]string{"config.cpp": `class CfgPatches {
+	class WLZ_Items {
+		units[] = {"WLZ_Cupcake"};
+		weapons[] = {"wlz_knife"};
+		requiredAddons[] = {"DZ_Data", "dz_gear_food"};
+	};
+};
+class CfgVehicles {
+	class Inventory_Base;
+	class WLZ_Cupcake: Inventory_Base {};
+};
+class CfgWeapons {
+	class WLZ_Knife {};
+};
+`},
+		},
+		{
+			name:     "missing CfgPatches",
+			configs:  map[string]string{"config.cpp": "class CfgVehicles {};\n"},
+			expected: []string{"config.cpp:1: no CfgPatches class"},
+		},
+		{
+			name:     "empty CfgPatches",
+			configs:  map[string]string{"config.cpp": "\nclass CfgPatches {};\n"},
+			expected: []string{"config.cpp:2: CfgPatches declares no addon"},
+		},
+		{
+			name: "undefined units and weapons",
+			configs: map[string]string{"config.cpp": `class CfgPatches {
+	class WLZ_Items {
+		units[] = {"WLZ_Cupcak"};
+		weapons[] = {"WLZ_Cupcake"};
+	};
+};
+class CfgVehicles {
+	class WLZ_Cupcake;
+};
+`},
+			expected: []string{
+				`config.cpp:3: WLZ_Items.units lists "WLZ_Cupcak", which is not defined in CfgVehicles`,
+				`config.cpp:4: WLZ_Items.weapons lists "WLZ_Cupcake", which is not defined in CfgWeapons`,
+			},
+		},
+		{
+			name: "unknown required addons",
+			configs: map[string]string{"config.cpp": `class CfgPatches {
+	class WLZ_Items {
+		requiredAddons[] = {"DZ_Dta", "WLZ_Core", "Other_Mod"};
+	};
+};
+`},
+			expected: []string{
+				`config.cpp:3: WLZ_Items.requiredAddons lists unknown addon "DZ_Dta"`,
+				`config.cpp:3: WLZ_Items.requiredAddons lists unknown addon "Other_Mod"`,
+			},
+		},
+		{
+			name: "classes and addons from other configs in the addon",
+			configs: map[string]string{
+				"config.cpp": `class CfgPatches {
+	class WLZ_Items {
+		units[] = {"WLZ_Cupcake"};
+		requiredAddons[] = {"WLZ_Food"};
+	};
+};
+`,
+				"food/config.cpp": `class CfgPatches {
+	class WLZ_Food {};
+};
+class CfgVehicles {
+	class WLZ_Cupcake {};
+};
+`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var configs []*Config
+			for _, name := range []string{"config.cpp", "food/config.cpp"} {
+				if data, ok := test.configs[name]; ok {
+					config, err := ParseConfig(name, []byte(data))
+					require.NoError(t, err)
+					configs = append(configs, config)
+				}
+			}
+
+			known := append(KnownAddons{"WLZ_*"}, defaultKnownAddons...)
+			assert.Equal(t, test.expected, LintConfigs(configs, known))
+		})
+	}
+}
+
+func TestKnownAddons(t *testing.T) {
+	var known KnownAddons
+	require.NoError(t, known.Set("CF, dabs_*"))
+	require.NoError(t, known.Set("VPPAdminTools"))
+	assert.Equal(t, KnownAddons{"CF", "dabs_*", "VPPAdminTools"}, known)
+
+	assert.True(t, known.Match("cf"))
+	assert.True(t, known.Match("DabS_Framework"))
+	assert.False(t, known.Match("CF_Extra"))
+
+	assert.Error(t, known.Set("[invalid"))
+}
+
+func TestWorkspaceAddons(t *testing.T) {
+	root := testFiles(t, map[string]string{
+		"WLZ_Core/config.cpp":   "#include \"macros.hpp\"\nclass CfgPatches { class ADDON {}; };\n",
+		"WLZ_Core/macros.hpp":   "#define ADDON WLZ_Core\n",
+		"WLZ_Broken/config.cpp": "class CfgPatches {\n",
+		"WLZ_Core/data/a.txt":   "not a config",
+	})
+
+	addons, err := workspaceAddons(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"WLZ_Core"}, addons)
+}
+
+func TestLintClasses(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name: "declared and defined bases",
+			config: `class Inventory_Base;
+class CfgVehicles {
+	class Edible_Base;
+	class WLZ_Food: Edible_Base {};
+	class WLZ_Cupcake: WLZ_Food {};
+	class WLZ_Crate: Inventory_Base {};
+};
+`,
+		},
+		{
+			name: "undefined base",
+			config: `class CfgVehicles {
+	class Edible_Base;
+	class WLZ_Cupcake: Edibel_Base {};
+};
+`,
+			expected: []string{"config.cpp:3: class WLZ_Cupcake inherits from undefined class Edibel_Base (declare it with class Edibel_Base;)"},
+		},
+		{
+			name: "base declared later",
+			config: `class CfgVehicles {
+	class WLZ_Cupcake: WLZ_Food {};
+	class WLZ_Food {};
+};
+`,
+			expected: []string{"config.cpp:2: class WLZ_Cupcake inherits from undefined class WLZ_Food (declare it with class WLZ_Food;)"},
+		},
+		{
+			name: "base in a sibling scope",
+			config: `class CfgWeapons {
+	class Knife_Base;
+};
+class CfgVehicles {
+	class WLZ_Knife: Knife_Base {};
+};
+`,
+			expected: []string{"config.cpp:5: class WLZ_Knife inherits from undefined class Knife_Base (declare it with class Knife_Base;)"},
+		},
+		{
+			name: "nested class inherited from an external base",
+			config: `class CfgVehicles {
+	class Clothing;
+	class WLZ_Shirt: Clothing {
+		class DamageSystem: DamageSystem {};
+	};
+};
+`,
+		},
+		{
+			name: "nested class inherited from a defined base",
+			config: `class CfgVehicles {
+	class WLZ_Base {
+		class DamageSystem {};
+	};
+	class WLZ_Shirt: WLZ_Base {
+		class DamageSystem: DamageSystem {};
+		class Hitpoints: Hitpoints {};
+	};
+};
+`,
+			expected: []string{"config.cpp:7: class Hitpoints inherits from undefined class Hitpoints (declare it with class Hitpoints;)"},
+		},
+		{
+			name: "duplicate classes",
+			config: `class CfgVehicles {
+	class WLZ_Cupcake;
+	class WLZ_Cupcake {};
+	class wlz_cupcake {};
+};
+`,
+			expected: []string{"config.cpp:4: class wlz_cupcake is already defined at config.cpp:3"},
+		},
+		{
+			name: "redefined after delete",
+			config: `class CfgVehicles {
+	class WLZ_Cupcake {};
+	delete WLZ_Cupcake;
+	class WLZ_Cupcake {};
+};
+`,
+		},
+		{
+			name: "same name in different scopes",
+			config: `class CfgVehicles {
+	class WLZ_Cupcake {};
+};
+class CfgWeapons {
+	class WLZ_Cupcake {};
+};
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := ParseConfig("config.cpp", []byte(test.config))
+			require.NoError(t, err)
+
+			var problems []string
+			lintClasses(&configScope{class: config.Root}, func(pos ConfigPos, format string, args ...any) {
+				problems = append(problems, fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, args...)))
+			})
+			assert.Equal(t, test.expected, problems)
+		})
+	}
+}
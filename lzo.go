@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// LZO1X, as used for compressed DXT mipmaps in PAA files. The compressor
+// follows the LZO1X-1 algorithm, without splitting the input into blocks.
+
+const (
+	lzoM2MaxLen    = 8
+	lzoM3MaxLen    = 33
+	lzoM4MaxLen    = 9
+	lzoM2MaxOffset = 0x0800
+	lzoM3MaxOffset = 0x4000
+	lzoM4MaxOffset = 0xbfff
+	lzoM3Marker    = 32
+	lzoM4Marker    = 16
+	lzoDictBits    = 14
+)
+
+var errLZOCorrupt = errors.New("corrupt lzo data")
+
+// compressLZO compresses in into an LZO1X stream, including the end of
+// stream marker.
+func compressLZO(in []byte) []byte {
+	out := make([]byte, 0, len(in)+len(in)/16+64+3)
+	dict := make([]int, 1<<lzoDictBits)
+	for i := range dict {
+		dict[i] = -1
+	}
+
+	ii := 0 // start of pending literals
+	if len(in) > 20 {
+		ipEnd := len(in) - 20
+		for ip := 5; ip < ipEnd; {
+			dv := binary.LittleEndian.Uint32(in[ip:])
+			h := (dv * 0x1824429d) >> (32 - lzoDictBits)
+			mPos := dict[h]
+			dict[h] = ip
+			if mPos < 0 || ip-mPos > lzoM4MaxOffset || dv != binary.LittleEndian.Uint32(in[mPos:]) {
+				// skip ahead faster the longer we go without a match
+				ip += 1 + (ip-ii)>>5
+				continue
+			}
+
+			out = lzoLiterals(out, in[ii:ip])
+
+			mLen := 4
+			for ip+mLen < ipEnd && in[ip+mLen] == in[mPos+mLen] {
+				mLen++
+			}
+			mOff := ip - mPos
+			ip += mLen
+			ii = ip
+
+			switch {
+			case mLen <= lzoM2MaxLen && mOff <= lzoM2MaxOffset:
+				mOff--
+				out = append(out, byte((mLen-1)<<5|(mOff&7)<<2), byte(mOff>>3))
+			case mOff <= lzoM3MaxOffset:
+				mOff--
+				if mLen <= lzoM3MaxLen {
+					out = append(out, byte(lzoM3Marker|(mLen-2)))
+				} else {
+					out = lzoLength(append(out, lzoM3Marker), mLen-lzoM3MaxLen)
+				}
+				out = append(out, byte(mOff<<2), byte(mOff>>6))
+			default:
+				mOff -= 0x4000
+				if mLen <= lzoM4MaxLen {
+					out = append(out, byte(lzoM4Marker|(mOff>>11)&8|(mLen-2)))
+				} else {
+					out = lzoLength(append(out, byte(lzoM4Marker|(mOff>>11)&8)), mLen-lzoM4MaxLen)
+				}
+				out = append(out, byte(mOff<<2), byte(mOff>>6))
+			}
+		}
+	}
+
+	out = lzoLiterals(out, in[ii:])
+	return append(out, lzoM4Marker|1, 0, 0)
+}
+
+// lzoLiterals appends a run of literal bytes. Runs of up to 3 bytes are
+// encoded in the low bits of the preceding match.
+func lzoLiterals(out, literals []byte) []byte {
+	t := len(literals)
+	switch {
+	case t == 0:
+		return out
+	case len(out) == 0 && t <= 238:
+		out = append(out, byte(17+t))
+	case t <= 3 && len(out) >= 2:
+		out[len(out)-2] |= byte(t)
+	case t <= 18:
+		out = append(out, byte(t-3))
+	default:
+		out = lzoLength(append(out, 0), t-18)
+	}
+	return append(out, literals...)
+}
+
+// lzoLength appends an extended length as a run of zero bytes, each counting
+// 255, followed by the remainder.
+func lzoLength(out []byte, n int) []byte {
+	for n > 255 {
+		out = append(out, 0)
+		n -= 255
+	}
+	return append(out, byte(n))
+}
+
+// decompressLZO expands an LZO1X stream into a buffer of the given size.
+func decompressLZO(in []byte, size int) ([]byte, error) {
+	// each byte of a run length adds at most 255 to a match, so a larger
+	// size can only come from a corrupt header
+	if size > len(in)*255 {
+		return nil, errLZOCorrupt
+	}
+	out := make([]byte, 0, size)
+	ip := 0
+
+	next := func() (int, error) {
+		if ip >= len(in) {
+			return 0, errLZOCorrupt
+		}
+		b := in[ip]
+		ip++
+		return int(b), nil
+	}
+	length := func(t, base int) (int, error) {
+		if t != 0 {
+			return t, nil
+		}
+		for {
+			b, err := next()
+			if err != nil {
+				return 0, err
+			}
+			if b != 0 {
+				return base + b, nil
+			}
+			base += 255
+		}
+	}
+	literals := func(t int) error {
+		if ip+t > len(in) || len(out)+t > size {
+			return errLZOCorrupt
+		}
+		out = append(out, in[ip:ip+t]...)
+		ip += t
+		return nil
+	}
+	copyMatch := func(distance, t int) error {
+		start := len(out) - distance
+		if start < 0 || len(out)+t > size {
+			return errLZOCorrupt
+		}
+		for i := 0; i < t; i++ {
+			out = append(out, out[start+i])
+		}
+		return nil
+	}
+
+	state := 0
+	if len(in) > 0 && in[0] > 17 {
+		t := int(in[0]) - 17
+		ip++
+		if err := literals(t); err != nil {
+			return nil, err
+		}
+		state = min(t, 4)
+	}
+
+	for {
+		t, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		var distance, count int
+		switch {
+		case t < 16 && state == 0:
+			count, err = length(t, 15)
+			if err != nil {
+				return nil, err
+			}
+			if err = literals(count + 3); err != nil {
+				return nil, err
+			}
+			state = 4
+			continue
+		case t < 16:
+			h, err := next()
+			if err != nil {
+				return nil, err
+			}
+			distance = t>>2 + h<<2 + 1
+			count = 2
+			if state == 4 {
+				distance += lzoM2MaxOffset
+				count = 3
+			}
+		case t >= 64:
+			h, err := next()
+			if err != nil {
+				return nil, err
+			}
+			distance = (t>>2)&7 + h<<3 + 1
+			count = t>>5 + 1
+		case t >= 32:
+			count, err = length(t&31, 31)
+			if err != nil {
+				return nil, err
+			}
+			count += 2
+			if ip+2 > len(in) {
+				return nil, errLZOCorrupt
+			}
+			d := int(binary.LittleEndian.Uint16(in[ip:]))
+			ip += 2
+			distance = d>>2 + 1
+			t = d
+		default:
+			count, err = length(t&7, 7)
+			if err != nil {
+				return nil, err
+			}
+			count += 2
+			if ip+2 > len(in) {
+				return nil, errLZOCorrupt
+			}
+			d := int(binary.LittleEndian.Uint16(in[ip:]))
+			ip += 2
+			distance = (t&8)<<11 + d>>2
+			if distance == 0 {
+				if len(out) != size {
+					return nil, errLZOCorrupt
+				}
+				return out, nil
+			}
+			distance += 0x4000
+			t = d
+		}
+
+		if err = copyMatch(distance, count); err != nil {
+			return nil, err
+		}
+		state = t & 3
+		if err = literals(state); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLZORoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	random := make([]byte, 100000)
+	rng.Read(random)
+
+	// a small alphabet gives plenty of short and long matches
+	mixed := make([]byte, 200000)
+	for i := range mixed {
+		mixed[i] = "abcd"[rng.Intn(4)]
+	}
+	copy(mixed[50000:], bytes.Repeat([]byte{0xff}, 30000))
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "empty", input: []byte{}},
+		{name: "tiny", input: []byte("abc")},
+		{name: "short", input: []byte("hello hello hello hello hello")},
+		{name: "zeros", input: make([]byte, 70000)},
+		{name: "random", input: random},
+		{name: "mixed", input: mixed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed := compressLZO(tt.input)
+			decompressed, err := decompressLZO(compressed, len(tt.input))
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(tt.input, decompressed), "round trip mismatch")
+		})
+	}
+
+	t.Run("compresses repetitive data", func(t *testing.T) {
+		compressed := compressLZO(make([]byte, 70000))
+		assert.Less(t, len(compressed), 1000)
+	})
+
+	t.Run("rejects truncated data", func(t *testing.T) {
+		compressed := compressLZO(mixed)
+		_, err := decompressLZO(compressed[:len(compressed)/2], len(mixed))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects sizes the input can't expand to", func(t *testing.T) {
+		compressed := compressLZO(make([]byte, 70000))
+		_, err := decompressLZO(compressed, len(compressed)*255+1)
+		assert.ErrorIs(t, err, errLZOCorrupt)
+	})
+}
+
+// TestLZOReference checks against streams in the LZO1X format as liblzo2
+// writes them, so the compressor and decompressor can't agree on a mistake.
+func TestLZOReference(t *testing.T) {
+	t.Run("compresses short input to literals as lzo1x_1 does", func(t *testing.T) {
+		// a literal run in the first byte (17 + length), then the end marker
+		assert.Equal(t, []byte{0x14, 'a', 'b', 'c', 0x11, 0x00, 0x00}, compressLZO([]byte("abc")))
+		assert.Equal(t, append(append([]byte{0x1e}, "hello world!!"...), 0x11, 0x00, 0x00), compressLZO([]byte("hello world!!")))
+	})
+
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{
+			// M2: 1LLDDDSS H, length 5 + L, distance (H << 3) + D + 1, then
+			// S literals
+			name:     "m2 match with a trailing literal",
+			input:    []byte{0x15, 'a', 'b', 'c', 'd', 0xed, 0x00, 'X', 0x11, 0x00, 0x00},
+			expected: "abcdabcdabcdX",
+		},
+		{
+			// M3: 001LLLLL, length 2 + L, then distance - 1 << 2 | S as 16 bits
+			name:     "m3 match",
+			input:    []byte{0x15, 'a', 'b', 'c', 'd', 0x22, 0x0c, 0x00, 0x11, 0x00, 0x00},
+			expected: "abcdabcd",
+		},
+		{
+			// a zero length continues in the next byte, 2 + 31 + 7, followed
+			// by a run of 3 + 2 literals
+			name:     "m3 match with an extended length and a literal run",
+			input:    []byte{0x15, 'a', 'b', 'c', 'd', 0x20, 0x07, 0x0c, 0x00, 0x02, 'v', 'w', 'x', 'y', 'z', 0x11, 0x00, 0x00},
+			expected: "abcd" + strings.Repeat("abcd", 10) + "vwxyz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decompressed, err := decompressLZO(tt.input, len(tt.expected))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(decompressed))
+		})
+	}
+}
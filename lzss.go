@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errLZSSCorrupt = errors.New("corrupt lzss data")
+
+// decompressLZSS expands the LZSS variant used by PBO entries and PAA
+// mipmaps. The expanded data is followed by a 32-bit checksum of its bytes.
+// It returns the expanded data and the number of input bytes consumed.
+func decompressLZSS(in []byte, size int) ([]byte, int, error) {
+	// a back reference of 2 bytes expands to at most 18, so a larger size
+	// can only come from a corrupt header
+	if size > len(in)*9 {
+		return nil, 0, errLZSSCorrupt
+	}
+	out := make([]byte, 0, size)
+	pos := 0
+
+	for len(out) < size {
+		if pos >= len(in) {
+			return nil, 0, errLZSSCorrupt
+		}
+		flags := in[pos]
+		pos++
+
+		for bit := 0; bit < 8 && len(out) < size; bit++ {
+			if flags&(1<<bit) != 0 {
+				if pos >= len(in) {
+					return nil, 0, errLZSSCorrupt
+				}
+				out = append(out, in[pos])
+				pos++
+				continue
+			}
+
+			if pos+1 >= len(in) {
+				return nil, 0, errLZSSCorrupt
+			}
+			offset := int(in[pos]) | int(in[pos+1]&0xf0)<<4
+			length := int(in[pos+1]&0x0f) + 3
+			pos += 2
+
+			start := len(out) - offset
+			if offset == 0 {
+				return nil, 0, errLZSSCorrupt
+			}
+			for i := 0; i < length && len(out) < size; i++ {
+				// references before the start of the data expand to spaces
+				if start+i < 0 {
+					out = append(out, ' ')
+				} else {
+					out = append(out, out[start+i])
+				}
+			}
+		}
+	}
+
+	if pos+4 > len(in) {
+		return nil, 0, errLZSSCorrupt
+	}
+	var sum uint32
+	for _, b := range out {
+		sum += uint32(b)
+	}
+	if expected := binary.LittleEndian.Uint32(in[pos:]); expected != sum {
+		return nil, 0, fmt.Errorf("lzss checksum mismatch: expected %08x, got %08x", expected, sum)
+	}
+
+	return out, pos + 4, nil
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
 )
 
 func must(err error) {
@@ -20,70 +24,242 @@ func must(err error) {
 
 func main() {
 	flags := flag.NewFlagSet("mod-build", flag.ExitOnError)
-	flags.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: %s [options] <source-directory>\n", filepath.Base(os.Args[0]))
-		flags.PrintDefaults()
-	}
-	var (
-		imgToPaaPath = flags.String("image-to-paa", `C:\Program Files (x86)\Steam\steamapps\common\DayZ Tools\Bin\ImageToPAA\ImageToPAA.exe`, "Path to the ImageToPAA executable")
-		outputRoot   = flags.String("output", `P:\`, "Path to the output directory root (where built addons will be placed)")
-		yes          = flags.Bool("yes", false, "Automatically confirm all prompts (use with caution)")
-		clean        = flags.Bool("clean", false, "Clean output directory before building (deletes files which are not present in the source)")
-		_            = flags.String("config", "", "config file (optional)")
-	)
-
-	err := ff.Parse(flags, os.Args[1:],
-		ff.WithConfigFileFlag("config"),
-		ff.WithConfigFileParser(ff.PlainParser),
-	)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		fmt.Fprintln(os.Stderr, "")
-		flags.Usage()
-		os.Exit(1)
+	opts := buildOptions{textureProfiles: slices.Clone(defaultTextureProfiles)}
+	flags.StringVar(&opts.converter, "converter", "image-to-paa", "Default image converter ("+strings.Join(converterNames(), ", ")+")")
+	flags.Var(&opts.converterRules, "converter-rule", "Image converter for files matching a pattern as pattern=converter, e.g. *_nohq.png=image-to-paa, may be repeated (first match wins)")
+	flags.StringVar(&opts.converterCommand, "converter-command", "", "Command template for the command converter, with {src}, {dst}, {srcdir}, {dstdir} and {workdir} placeholders (add :win for Wine paths, e.g. {src:win})")
+	flags.StringVar(&opts.converterDir, "converter-dir", "", "Working directory for converter commands, may use the same placeholders (defaults to the current directory)")
+	flags.Var(&opts.converterEnv, "converter-env", "Environment variable for converter commands as KEY=VALUE, may be repeated")
+	flags.IntVar(&opts.maxTextureSize, "max-texture-size", 4096, "Maximum width and height of images to convert")
+	flags.Var(&opts.textureProfiles, "texture-profile", "Texture profile for the builtin converter as _suffix=format[,filter], may be repeated (format: auto, dxt1 or dxt5, filter: box, normalmap or fadeout)")
+	flags.StringVar(&opts.imgToPaaPath, "image-to-paa", `C:\Program Files (x86)\Steam\steamapps\common\DayZ Tools\Bin\ImageToPAA\ImageToPAA.exe`, "Path to the ImageToPAA executable")
+	flags.StringVar(&opts.pal2PacEPath, "pal2pace", `C:\Program Files (x86)\Steam\steamapps\common\DayZ Tools\Bin\TexView2\Pal2PacE.exe`, "Path to the Pal2PacE executable")
+	flags.StringVar(&opts.outputRoot, "output", `P:\`, "Path to the output directory root (where built addons will be placed)")
+	flags.StringVar(&opts.packDir, "pack", "", "Path to the directory to write the packed PBO to (optional, skips packing if empty)")
+	flags.StringVar(&opts.signKey, "sign", "", "Path to a .biprivatekey to sign the packed PBO with (requires -pack)")
+	opts.passphrase.register(flags)
+	flags.StringVar(&opts.keysDir, "keys", "", "Directory to write the public .bikey to when signing (defaults to keys next to the -pack directory)")
+	flags.StringVar(&opts.modDir, "mod", "", "Path to the mod folder, where root level directories starting with _ are copied (optional)")
+	flags.BoolVar(&opts.rapify, "rapify", false, "Rapify config.cpp files to config.bin instead of copying them")
+	flags.BoolVar(&opts.lint, "lint", false, "Check config.cpp files for mistakes (undefined base classes, CfgPatches) before building")
+	opts.lintOptions.register(flags)
+	flags.BoolVar(&opts.rewriteImages, "rewrite-images", false, "Rewrite references to .png and .jpg images in configs, materials and layouts to the converted .paa")
+	flags.BoolVar(&opts.checkReferences, "check-references", false, "Check that asset paths in configs, materials and layouts exist in the output after building")
+	flags.Var(&opts.referenceAllow, "reference-allow", `Path prefix of asset references which are not checked, in addition to DZ\, may be repeated`)
+	flags.BoolVar(&opts.yes, "yes", false, "Automatically confirm all prompts (use with caution)")
+	flags.BoolVar(&opts.clean, "clean", false, "Clean output directory before building (deletes files which are not present in the source)")
+	_ = flags.String("config", "", "config file (optional)")
+
+	root := &ffcli.Command{
+		Name:       "mod-build",
+		ShortUsage: fmt.Sprintf("%s [options] <source-directory>", filepath.Base(os.Args[0])),
+		LongHelp: "Build the addon in <source-directory>. Command names are matched first, so a\n" +
+			"source directory with the name of a command, such as pack, is given as a\n" +
+			"path, e.g. ./pack.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Options: []ff.Option{
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+		},
+		Subcommands: []*ffcli.Command{
+			newPackCommand(),
+			newExtractCommand(),
+			newPAA2PNGCommand(),
+			newDerapifyCommand(),
+			newLintCommand(),
+			newConfigCommand(),
+			newFmtCommand(),
+			newKeygenCommand(),
+			newVerifySignatureCommand(),
+			newEncryptKeyCommand(),
+			newAssembleCommand(),
+		},
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 || args[0] == "" {
+				fmt.Fprintln(os.Stderr, "error: source directory is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			build(args[0], opts)
+			return nil
+		},
 	}
 
-	sourceDir := flags.Arg(0)
-	if sourceDir == "" {
-		fmt.Fprintln(os.Stderr, "error: source directory is required")
-		fmt.Fprintln(os.Stderr, "")
-		flags.Usage()
+	err := root.ParseAndRun(context.Background(), os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
 		os.Exit(1)
 	}
+	must(err)
+}
 
-	addonName := filepath.Base(sourceDir) // TODO: Or from $PBOPREFIX@.txt?
-	outputDirectory := filepath.Join(*outputRoot, addonName)
+func usage(c *ffcli.Command) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "usage: %s\n", c.ShortUsage)
+	if c.LongHelp != "" {
+		fmt.Fprintf(&b, "\n%s\n", c.LongHelp)
+	}
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintln(&b, "\ncommands:")
+		for _, subcommand := range c.Subcommands {
+			fmt.Fprintf(&b, "  %-16s %s\n", subcommand.Name, subcommand.ShortHelp)
+		}
+		hasFlags := false
+		c.FlagSet.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(&b, "\noptions:")
+		}
+	} else if c.LongHelp != "" {
+		fmt.Fprintln(&b, "")
+	}
+	c.FlagSet.SetOutput(&b)
+	c.FlagSet.PrintDefaults()
+	c.FlagSet.SetOutput(nil)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+type buildOptions struct {
+	converter        string
+	converterRules   ConverterRules
+	converterCommand string
+	converterDir     string
+	converterEnv     converterEnv
+	textureProfiles  TextureProfiles
+	maxTextureSize   int
+	imgToPaaPath     string
+	pal2PacEPath     string
+	outputRoot       string
+	packDir          string
+	signKey          string
+	passphrase       passphraseSource
+	keysDir          string
+	modDir           string
+	rapify           bool
+	lint             bool
+	lintOptions      lintOptions
+	rewriteImages    bool
+	checkReferences  bool
+	referenceAllow   referencePrefixes
+	yes              bool
+	clean            bool
+}
+
+func build(sourceDir string, opts buildOptions) {
+	source := NewSource(sourceDir)
+	must(source.EnsureValid())
+
+	prefix, err := source.Prefix()
+	must(err)
+	addonName := prefix
+	if addonName == "" {
+		fmt.Fprintf(os.Stderr, "⚠️ No %s found, using the source directory name as the addon name\n", prefixFile)
+		addonName = filepath.Base(sourceDir)
+	}
+	outputDirectory := filepath.Join(opts.outputRoot, prefixPath(addonName))
+
+	converters, err := NewConverters(opts.converter, opts.converterRules, converterConfig{
+		imageToPAAPath: opts.imgToPaaPath,
+		pal2PacEPath:   opts.pal2PacEPath,
+		command:        opts.converterCommand,
+		commandDir:     opts.converterDir,
+		env:            opts.converterEnv,
+	})
+	must(err)
 
 	fmt.Println("===================================================")
-	fmt.Printf("ImageToPAA Path: %s\n", *imgToPaaPath)
+	fmt.Printf("      Converter: %s\n", opts.converter)
+	for _, rule := range opts.converterRules {
+		fmt.Printf(" Converter Rule: %s=%s\n", rule.Pattern, rule.Backend)
+	}
+	fmt.Printf("ImageToPAA Path: %s\n", opts.imgToPaaPath)
+	fmt.Printf("  Pal2PacE Path: %s\n", opts.pal2PacEPath)
 	fmt.Printf("    Source Path: %s\n", sourceDir)
-	fmt.Printf("    Output Root: %s\n", *outputRoot)
-	fmt.Printf("   Auto-confirm: %t\n", *yes)
-	fmt.Printf("          Clean: %t\n", *clean)
+	fmt.Printf("    Output Root: %s\n", opts.outputRoot)
+	fmt.Printf("      Pack Path: %s\n", opts.packDir)
+	fmt.Printf("       Sign Key: %s\n", opts.signKey)
+	fmt.Printf("     Mod Folder: %s\n", opts.modDir)
+	fmt.Printf("         Rapify: %t\n", opts.rapify)
+	fmt.Printf("           Lint: %t\n", opts.lint)
+	fmt.Printf(" Rewrite Images: %t\n", opts.rewriteImages)
+	fmt.Printf("     References: %t\n", opts.checkReferences)
+	fmt.Printf("   Auto-confirm: %t\n", opts.yes)
+	fmt.Printf("          Clean: %t\n", opts.clean)
 	fmt.Println("---------------------------------------------------")
 	fmt.Printf("      Addon Name: %s\n", addonName)
 	fmt.Printf("Output Directory: %s\n", outputDirectory)
 	fmt.Println("===================================================")
 
-	source := NewSource(sourceDir)
-	must(source.EnsureValid())
+	var signKey *BIPrivateKey
+	if opts.signKey != "" {
+		if opts.packDir == "" {
+			must(fmt.Errorf("-sign requires -pack"))
+		}
+		signKey, err = readBIPrivateKeyFile(opts.signKey, opts.passphrase)
+		must(err)
+	}
 
 	output := NewOutput(outputDirectory)
 	must(output.EnsureExists())
 
-	confirm, err := yesOrNo(*yes, fmt.Sprintf("⚠️ The contents of %q will be removed or replaced. Continue? [y/N] ", outputDirectory))
+	confirm, err := yesOrNo(opts.yes, fmt.Sprintf("⚠️ The contents of %q will be removed or replaced. Continue? [y/N] ", outputDirectory))
 	must(err)
 	if !confirm {
 		os.Exit(0)
 	}
 
+	var modOutput *Output
+	if opts.modDir != "" {
+		modOutput = NewOutput(opts.modDir)
+		must(modOutput.EnsureExists())
+
+		confirm, err := yesOrNo(opts.yes, fmt.Sprintf("⚠️ The contents of %q will be removed or replaced. Continue? [y/N] ", opts.modDir))
+		must(err)
+		if !confirm {
+			os.Exit(0)
+		}
+	}
+
 	task, err := source.Prepare()
 	must(err)
 
 	outputManifest, err := output.LoadManifest()
 	must(err)
 
-	if *clean {
+	for _, path := range task.Convert {
+		backend, converter := converters.For(path)
+		profile, _ := opts.textureProfile(backend, path)
+		entry := task.Manifest[path]
+		entry.SourceHash = conversionHash(entry.SourceHash, backend, converter, profile)
+		task.Manifest[path] = entry
+	}
+
+	problems := 0
+	for _, path := range task.Convert {
+		// images are only checked when they are converted again, by the
+		// same check as the conversion below
+		if isUnchanged(output, outputManifest[path].OutputPath, task.Manifest[path].SourceHash, outputManifest[path].SourceHash, outputManifest[path].OutputHash) {
+			continue
+		}
+		imageProblems, err := validateImage(source.RealPath(path), path, opts.maxTextureSize)
+		must(err)
+		for _, problem := range imageProblems {
+			fmt.Fprintf(os.Stderr, "❌ Invalid    : %q: %s\n", path, problem)
+		}
+		problems += len(imageProblems)
+	}
+	if problems > 0 {
+		must(fmt.Errorf("found %d problems with the images to convert", problems))
+	}
+
+	if opts.lint {
+		problems, err := lintAddon(sourceDir, prefix, task.Copy, opts.lintOptions)
+		must(err)
+		if problems > 0 {
+			must(fmt.Errorf("found %d problems in the configs", problems))
+		}
+	}
+
+	if opts.clean {
 		toClean, err := output.PathsToClean(task)
 		must(err)
 
@@ -93,7 +269,56 @@ func main() {
 		}
 	}
 
+	preprocessor := NewPreprocessor(sourceDir, prefix)
+	var rewriter *imageRewriter
+	if opts.rewriteImages {
+		rewriter = newImageRewriter(addonName, task.Convert)
+	}
 	for _, path := range task.Copy {
+		if opts.rapify && isRapifiable(path) {
+			entry := task.Manifest[path]
+			entry.SourceHash = rewriter.SourceHash(entry.SourceHash)
+			if outputManifest[path].OutputPath == rapifiedPath(path) &&
+				isUnchanged(output, outputManifest[path].OutputPath, entry.SourceHash, outputManifest[path].SourceHash, outputManifest[path].OutputHash) &&
+				!source.DependenciesChanged(outputManifest[path].Dependencies) {
+				fmt.Printf("⏭️ Unchanged  : %q\n", path)
+				entry.OutputPath = outputManifest[path].OutputPath
+				entry.OutputHash = outputManifest[path].OutputHash
+				entry.Dependencies = outputManifest[path].Dependencies
+				task.Manifest[path] = entry
+				continue
+			}
+			fmt.Printf("⚙️ Rapifying  : %q\n", path)
+			outputPath, outputHash, included, err := output.Rapify(preprocessor, rewriter, path)
+			must(err)
+			entry.OutputPath = outputPath
+			entry.OutputHash = outputHash
+			entry.Dependencies, err = source.Dependencies(included)
+			must(err)
+			task.Manifest[path] = entry
+			continue
+		}
+		if rewriter != nil && shouldRewrite(path) {
+			data, err := os.ReadFile(source.RealPath(path))
+			must(err)
+			text, images := rewriter.Rewrite(string(data))
+			if len(images) > 0 {
+				entry := task.Manifest[path]
+				entry.OutputPath = path
+				entry.OutputHash = hashData([]byte(text))
+				entry.Dependencies, err = source.Dependencies(images)
+				must(err)
+				task.Manifest[path] = entry
+				if isUnchanged(output, path, entry.SourceHash, outputManifest[path].SourceHash, entry.OutputHash) {
+					fmt.Printf("⏭️ Unchanged  : %q\n", path)
+					continue
+				}
+				fmt.Printf("✏️ Rewriting  : %q\n", path)
+				_, err = output.Write(path, []byte(text))
+				must(err)
+				continue
+			}
+		}
 		if isUnchanged(output, path, task.Manifest[path].SourceHash, outputManifest[path].SourceHash, outputManifest[path].SourceHash) {
 			fmt.Printf("⏭️ Unchanged  : %q\n", path)
 			continue
@@ -103,18 +328,22 @@ func main() {
 	}
 
 	for _, path := range task.Convert {
-		if isUnchanged(output, outputManifest[path].OutputPath, task.Manifest[path].SourceHash, outputManifest[path].SourceHash, outputManifest[path].OutputHash) {
+		backend, converter := converters.For(path)
+		profile, matched := opts.textureProfile(backend, path)
+		entry := task.Manifest[path]
+		if isUnchanged(output, outputManifest[path].OutputPath, entry.SourceHash, outputManifest[path].SourceHash, outputManifest[path].OutputHash) {
 			fmt.Printf("⏭️ Unchanged  : %q\n", path)
-			entry := task.Manifest[path]
 			entry.OutputPath = outputManifest[path].OutputPath
 			entry.OutputHash = outputManifest[path].OutputHash
 			task.Manifest[path] = entry
 			continue
 		}
-		fmt.Printf("🔁 Converting : %q\n", path)
-		outputPath, outputHash, err := output.Convert(source.RealPath(path), path, *imgToPaaPath)
+		if !matched {
+			fmt.Fprintf(os.Stderr, "⚠️ No texture profile for %q (unrecognised suffix), using defaults\n", path)
+		}
+		fmt.Printf("🔁 Converting : %q (%s)\n", path, backend)
+		outputPath, outputHash, err := output.Convert(source.RealPath(path), path, converter, profile)
 		must(err)
-		entry := task.Manifest[path]
 		entry.OutputPath = outputPath
 		entry.OutputHash = outputHash
 		task.Manifest[path] = entry
@@ -125,9 +354,99 @@ func main() {
 		fmt.Fprintf(os.Stderr, "⚠️ Failed to write manifest file: %v\n", err)
 	}
 
+	if opts.checkReferences {
+		checker := newReferenceChecker(prefix, task.Manifest, opts.outputRoot, opts.referenceAllow)
+		problems, err := checkReferences(source, preprocessor, rewriter, task.Copy, checker)
+		must(err)
+		if problems > 0 {
+			must(fmt.Errorf("found %d broken asset references", problems))
+		}
+	}
+
+	if modOutput != nil {
+		buildModFolder(source, task, modOutput, opts.clean)
+	} else if len(task.ModCopy) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ Skipping %d mod folder files, -mod is not set\n", len(task.ModCopy))
+	}
+
+	if opts.packDir != "" {
+		if prefix == "" {
+			fmt.Fprintf(os.Stderr, "⚠️ No %s found, packing without a prefix\n", prefixFile)
+		}
+		pboPath := filepath.Join(opts.packDir, prefixName(addonName)+".pbo")
+		fmt.Printf("📦 Packing    : %q\n", pboPath)
+		must(output.Pack(pboPath, prefix, task.Manifest))
+
+		if signKey != nil {
+			fmt.Printf("✍️ Signing    : %q\n", pboPath)
+			_, err := signPBOFile(pboPath, signKey)
+			must(err)
+
+			keysDir := opts.keysDir
+			if keysDir == "" {
+				keysDir = filepath.Join(filepath.Dir(filepath.Clean(opts.packDir)), "keys")
+			}
+			keyPath := filepath.Join(keysDir, signKey.Authority+".bikey")
+			fmt.Printf("🔑 Writing    : %q\n", keyPath)
+			must(saveBIKey(keyPath, signKey.Public()))
+		}
+	}
+
 	fmt.Println("🎉 Done!")
 }
 
+// textureProfile returns the texture profile for the image at path, and
+// whether its suffix matched one. Profiles only apply to the builtin
+// converter.
+func (opts buildOptions) textureProfile(backend, path string) (TextureProfile, bool) {
+	if backend != "builtin" {
+		return TextureProfile{}, true
+	}
+	return opts.textureProfiles.Match(path)
+}
+
+// buildModFolder copies the contents of root level _ directories to the mod
+// folder, which has its own manifest.
+func buildModFolder(source *Source, task *Task, modOutput *Output, clean bool) {
+	modManifest, err := modOutput.LoadManifest()
+	must(err)
+
+	// files put in the mod folder by assemble are kept
+	for path, entry := range modManifest {
+		if !strings.HasPrefix(path, "_") {
+			task.ModManifest[path] = entry
+		}
+	}
+
+	if clean {
+		// only files recorded by earlier builds are deleted, the mod folder
+		// may hold others, such as PBOs when -pack is inside it
+		for _, path := range modOutput.PathsToCleanFromPrevious(modManifest, task.ModManifest) {
+			fmt.Printf("🧹 Deleting   : %q\n", path)
+			must(modOutput.Remove(path))
+			modOutput.RemoveEmptyParents(path)
+		}
+	}
+
+	for _, path := range task.ModCopy {
+		entry := task.ModManifest[path]
+		entry.OutputHash = entry.SourceHash
+		task.ModManifest[path] = entry
+
+		if isUnchanged(modOutput, entry.OutputPath, entry.SourceHash, modManifest[path].SourceHash, modManifest[path].OutputHash) {
+			fmt.Printf("⏭️ Unchanged  : %q\n", path)
+			continue
+		}
+		fmt.Printf("📄 Copying    : %q\n", path)
+		must(modOutput.Copy(source.RealPath(path), entry.OutputPath))
+	}
+
+	err = modOutput.WriteManifest(task.ModManifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Failed to write mod folder manifest file: %v\n", err)
+	}
+}
+
 func isUnchanged(output *Output, outputPath, taskSourceHash, outputSourceHash, outputHash string) bool {
 	if outputSourceHash == taskSourceHash {
 		hash, err := output.Hash(outputPath)
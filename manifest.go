@@ -13,6 +13,15 @@ type ManifestEntry struct {
 	SourceHash string
 	OutputPath string
 	OutputHash string
+	// Dependencies are the other source files the output was built from,
+	// such as the files included by a rapified config.
+	Dependencies []ManifestDependency
+}
+
+// ManifestDependency is a source file path and its hash.
+type ManifestDependency struct {
+	Path string
+	Hash string
 }
 
 type Manifest map[string]ManifestEntry
@@ -35,16 +44,23 @@ func LoadManifest(in io.Reader) (Manifest, error) {
 				OutputHash: parts[1],
 			}
 
-		} else if len(parts) == 4 {
-			if !hashRegexp.MatchString(parts[1]) || !hashRegexp.MatchString(parts[3]) {
-				return nil, fmt.Errorf("invalid hash in manifest line: %s", scanner.Text())
-			}
-			manifest[parts[0]] = ManifestEntry{
+		} else if len(parts) >= 4 && len(parts)%2 == 0 {
+			// dependencies follow the output as path and hash pairs
+			entry := ManifestEntry{
 				SourcePath: parts[0],
 				SourceHash: parts[1],
 				OutputPath: parts[2],
 				OutputHash: parts[3],
 			}
+			for i := 1; i < len(parts); i += 2 {
+				if !hashRegexp.MatchString(parts[i]) {
+					return nil, fmt.Errorf("invalid hash in manifest line: %s", scanner.Text())
+				}
+				if i >= 5 {
+					entry.Dependencies = append(entry.Dependencies, ManifestDependency{Path: parts[i-1], Hash: parts[i]})
+				}
+			}
+			manifest[parts[0]] = entry
 		} else {
 			return nil, fmt.Errorf("invalid manifest line: %s", scanner.Text())
 		}
@@ -57,7 +73,11 @@ func StoreManifest(out io.Writer, manifest Manifest) error {
 	var err error
 	for _, entry := range manifest {
 		if entry.OutputPath != "" && entry.OutputHash != "" {
-			_, err = fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", entry.SourcePath, entry.SourceHash, entry.OutputPath, entry.OutputHash)
+			parts := []string{entry.SourcePath, entry.SourceHash, entry.OutputPath, entry.OutputHash}
+			for _, dependency := range entry.Dependencies {
+				parts = append(parts, dependency.Path, dependency.Hash)
+			}
+			_, err = fmt.Fprintln(out, strings.Join(parts, "\t"))
 		} else {
 			_, err = fmt.Fprintf(out, "%s\t%s\n", entry.SourcePath, entry.SourceHash)
 		}
@@ -89,6 +89,23 @@ func TestLoadManifest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:  "valid entry with dependencies (8 parts)",
+			input: "config.cpp\tabcdef0123456789\tconfig.bin\t1234567890abcdef\tmacros.hpp\t0123456789abcdef\tdata/classes.hpp\tfedcba9876543210\n",
+			want: Manifest{
+				"config.cpp": ManifestEntry{
+					SourcePath: "config.cpp",
+					SourceHash: "abcdef0123456789",
+					OutputPath: "config.bin",
+					OutputHash: "1234567890abcdef",
+					Dependencies: []ManifestDependency{
+						{Path: "macros.hpp", Hash: "0123456789abcdef"},
+						{Path: "data/classes.hpp", Hash: "fedcba9876543210"},
+					},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name:    "empty input",
 			input:   "",
@@ -113,6 +130,18 @@ func TestLoadManifest(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name:    "invalid format - 7 parts",
+			input:   "config.cpp\tabcdef0123456789\tconfig.bin\t1234567890abcdef\tmacros.hpp\t0123456789abcdef\tmore\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "invalid hash - dependency hash invalid (6 part)",
+			input:   "config.cpp\tabcdef0123456789\tconfig.bin\t1234567890abcdef\tmacros.hpp\tgbcdef0123456789\n",
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:    "invalid hash - too short (2 part)",
 			input:   "file.txt\tabcdef012345678\n",
@@ -209,6 +238,21 @@ func TestStoreManifest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "entry with dependencies",
+			manifest: Manifest{
+				"config.cpp": ManifestEntry{
+					SourcePath: "config.cpp",
+					SourceHash: "abcdef0123456789",
+					OutputPath: "config.bin",
+					OutputHash: "1234567890abcdef",
+					Dependencies: []ManifestDependency{
+						{Path: "macros.hpp", Hash: "0123456789abcdef"},
+					},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name:     "empty manifest",
 			manifest: Manifest{},
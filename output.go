@@ -61,6 +61,27 @@ func (o *Output) Copy(src, dst string) error {
 	return copyFileWithPath(src, filepath.Join(o.path, dst))
 }
 
+// Write writes data to path in the output, and returns its hash.
+func (o *Output) Write(path string, data []byte) (string, error) {
+	dst := filepath.Join(o.path, path)
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(dst, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	return hashData(data), nil
+}
+
+// hashData returns the hash of data, as recorded in the manifest.
+func hashData(data []byte) string {
+	hash := fnv.New64a()
+	hash.Write(data)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
 func (o *Output) Hash(path string) (string, error) {
 	hash := fnv.New64a()
 
@@ -78,12 +99,13 @@ func (o *Output) Hash(path string) (string, error) {
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-func (o *Output) Convert(src, dst, imgToPaaPath string) (string, string, error) {
+func (o *Output) Convert(src, dst string, converter Converter, profile TextureProfile) (string, string, error) {
 	dstFile := swapExtension(dst, ".paa")
 	err := convertWithPath(
 		src,
 		filepath.Join(o.path, dstFile),
-		imgToPaaPath,
+		converter,
+		profile,
 	)
 	if err != nil {
 		return "", "", err
@@ -94,17 +116,98 @@ func (o *Output) Convert(src, dst, imgToPaaPath string) (string, string, error)
 	return dstFile, hash, err
 }
 
+// Rapify preprocesses the config at path in the source and writes it
+// rapified to config.bin, and returns the output path, its hash and the
+// files it depends on (see rapifyFile).
+func (o *Output) Rapify(preprocessor *Preprocessor, rewriter *imageRewriter, path string) (string, string, []string, error) {
+	dstFile := rapifiedPath(path)
+	included, err := rapifyFile(preprocessor, rewriter, path, filepath.Join(o.path, dstFile))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	hash, err := o.Hash(dstFile)
+
+	return dstFile, hash, included, err
+}
+
+// Files returns the output paths recorded in manifest, sorted by their
+// lower-cased name.
+func (o *Output) Files(manifest Manifest) []string {
+	files := make([]string, 0, len(manifest))
+	for _, entry := range manifest {
+		outputPath := entry.OutputPath
+		if outputPath == "" {
+			outputPath = entry.SourcePath
+		}
+		files = append(files, outputPath)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return strings.ToLower(files[i]) < strings.ToLower(files[j])
+	})
+	return files
+}
+
+// Pack writes the files in manifest to a PBO at dst, storing prefix in the
+// PBO header. The prefix file itself is not packed.
+func (o *Output) Pack(dst, prefix string, manifest Manifest) error {
+	files := []string{}
+	for _, path := range o.Files(manifest) {
+		if path == prefixFile {
+			continue
+		}
+		files = append(files, path)
+	}
+
+	properties := []PBOProperty{}
+	if prefix != "" {
+		properties = append(properties, PBOProperty{Key: "prefix", Value: prefix})
+	}
+
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = PackPBO(f, o.path, files, properties)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Prefix returns the addon prefix from the prefix file in the output
+// directory, or an empty string if there is none.
+func (o *Output) Prefix() (string, error) {
+	prefix, err := readPrefixFile(filepath.Join(o.path, prefixFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return prefix, err
+}
+
 func (o *Output) PathsToClean(task *Task) ([]string, error) {
+	return o.PathsToCleanFromManifest(task.Manifest)
+}
+
+// PathsToCleanFromManifest returns the files and directories in the output
+// which are not required by the entries in manifest.
+func (o *Output) PathsToCleanFromManifest(manifest Manifest) ([]string, error) {
 	// files and directories to delete
 	toClean := []string{}
 	// a map of output files
-	requiredOutputs := make(map[string]struct{}, len(task.Manifest))
+	requiredOutputs := make(map[string]struct{}, len(manifest))
 	// a map of the directories required for those files
-	requiredDirs := make(map[string]struct{}, len(task.Manifest))
+	requiredDirs := make(map[string]struct{}, len(manifest))
 	// directories which exist in the output root
 	dirs := []string{}
 
-	for _, entry := range task.Manifest {
+	for _, entry := range manifest {
 		outputPath := entry.OutputPath
 		if outputPath == "" {
 			outputPath = entry.SourcePath
@@ -159,6 +262,39 @@ func (o *Output) PathsToClean(task *Task) ([]string, error) {
 	return toClean, err
 }
 
+// PathsToCleanFromPrevious returns the outputs of the entries of previous
+// which are no longer outputs of manifest and still exist. Unlike
+// PathsToCleanFromManifest it only considers files an earlier build wrote, so
+// other files in a shared directory are left alone.
+func (o *Output) PathsToCleanFromPrevious(previous, manifest Manifest) []string {
+	required := make(map[string]struct{}, len(manifest))
+	for _, entry := range manifest {
+		required[entry.OutputPath] = struct{}{}
+	}
+
+	toClean := []string{}
+	for _, entry := range previous {
+		if _, ok := required[entry.OutputPath]; ok || entry.OutputPath == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(o.path, entry.OutputPath)); err == nil {
+			toClean = append(toClean, entry.OutputPath)
+		}
+	}
+	sort.Strings(toClean)
+	return toClean
+}
+
+// RemoveEmptyParents removes the directories above path which are empty,
+// stopping at the first which is not.
+func (o *Output) RemoveEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+		if os.Remove(filepath.Join(o.path, dir)) != nil {
+			return
+		}
+	}
+}
+
 func (o *Output) Remove(path string) error {
 	return os.Remove(filepath.Join(o.path, path))
 }
@@ -189,3 +189,31 @@ func writeOutputTestFile(t *testing.T, root, relativePath, contents string) {
 	err = os.WriteFile(fullPath, []byte(contents), 0644)
 	require.NoError(t, err)
 }
+
+func TestOutput_PathsToCleanFromPrevious(t *testing.T) {
+	t.Run("only schedules outputs of earlier builds", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		output := NewOutput(tmpDir)
+
+		writeOutputTestFile(t, tmpDir, "keys/WILDLANDZ.bikey", "key")
+		writeOutputTestFile(t, tmpDir, "extras/old/readme.md", "old")
+		writeOutputTestFile(t, tmpDir, "addons/WILDLANDZ_Anniversary.pbo", "pbo")
+
+		previous := Manifest{
+			"_keys/WILDLANDZ.bikey": {SourcePath: "_keys/WILDLANDZ.bikey", OutputPath: "keys/WILDLANDZ.bikey"},
+			"_extras/old/readme.md": {SourcePath: "_extras/old/readme.md", OutputPath: "extras/old/readme.md"},
+			"_extras/gone.md":       {SourcePath: "_extras/gone.md", OutputPath: "extras/gone.md"},
+		}
+		manifest := Manifest{
+			"_keys/WILDLANDZ.bikey": {SourcePath: "_keys/WILDLANDZ.bikey", OutputPath: "keys/WILDLANDZ.bikey"},
+		}
+
+		toClean := output.PathsToCleanFromPrevious(previous, manifest)
+		assert.Equal(t, []string{"extras/old/readme.md"}, toClean)
+
+		require.NoError(t, output.Remove(toClean[0]))
+		output.RemoveEmptyParents(toClean[0])
+		assert.NoDirExists(t, filepath.Join(tmpDir, "extras"))
+		assert.FileExists(t, filepath.Join(tmpDir, "addons", "WILDLANDZ_Anniversary.pbo"))
+	})
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+const (
+	paaDXT1     uint16 = 0xff01
+	paaDXT5     uint16 = 0xff05
+	paaARGB4444 uint16 = 0x4444
+	paaARGB1555 uint16 = 0x1555
+	paaARGB8888 uint16 = 0x8888
+	paaAI88     uint16 = 0x8080
+
+	// paaMaxMipmaps is the number of entries in the mipmap offset table
+	paaMaxMipmaps = 16
+	// paaLZOFlag marks a mipmap width whose data is LZO compressed
+	paaLZOFlag = 0x8000
+)
+
+// paaMipmap is a single level of a PAA texture, as stored in the file.
+type paaMipmap struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// EncodePAA writes img to w as a PAA texture with a full mipmap chain, using
+// the format and mipmap filter of profile. With the auto format, opaque
+// images are stored as DXT1 and images with alpha as DXT5.
+func EncodePAA(w io.Writer, img image.Image, profile TextureProfile) error {
+	src := toNRGBA(img)
+	bounds := src.Bounds()
+	if bounds.Dx() > 0x7fff || bounds.Dy() > 0x7fff {
+		return fmt.Errorf("image is too large (%dx%d)", bounds.Dx(), bounds.Dy())
+	}
+
+	format := paaDXT1
+	if profile.Format == "dxt5" || (profile.Format == "auto" && hasAlpha(src)) {
+		format = paaDXT5
+	}
+
+	mipmaps := []paaMipmap{}
+	for level := src; len(mipmaps) < paaMaxMipmaps; level = downsample(level) {
+		if len(mipmaps) > 0 {
+			filterMipmap(level, profile.Filter)
+		}
+
+		mipmap := paaMipmap{Width: level.Bounds().Dx(), Height: level.Bounds().Dy()}
+		if format == paaDXT1 {
+			mipmap.Data = compressDXT1(level)
+		} else {
+			mipmap.Data = compressDXT5(level)
+		}
+		mipmaps = append(mipmaps, mipmap)
+
+		if mipmap.Width <= 4 || mipmap.Height <= 4 {
+			break
+		}
+	}
+
+	return writePAA(w, format, paaTaggs(src, format), mipmaps)
+}
+
+// paaTaggs builds the average colour, maximum colour and flag taggs for img.
+func paaTaggs(img *image.NRGBA, format uint16) map[string][]byte {
+	var sum [4]uint64
+	for i := 0; i < len(img.Pix); i += 4 {
+		for k := 0; k < 4; k++ {
+			sum[k] += uint64(img.Pix[i+k])
+		}
+	}
+	pixels := uint64(max(1, len(img.Pix)/4))
+	average := uint32(sum[3]/pixels)<<24 | uint32(sum[0]/pixels)<<16 | uint32(sum[1]/pixels)<<8 | uint32(sum[2]/pixels)
+
+	taggs := map[string][]byte{
+		"AVGC": binary.LittleEndian.AppendUint32(nil, average),
+		"MAXC": binary.LittleEndian.AppendUint32(nil, 0xffffffff),
+	}
+	if format == paaDXT5 {
+		taggs["FLAG"] = binary.LittleEndian.AppendUint32(nil, 1)
+	}
+	return taggs
+}
+
+// writePAA writes the header, taggs and mipmaps of a DXT texture. Mipmaps
+// are LZO compressed where that makes them smaller.
+func writePAA(w io.Writer, format uint16, taggs map[string][]byte, mipmaps []paaMipmap) error {
+	var buf bytes.Buffer
+	buf.Write(binary.LittleEndian.AppendUint16(nil, format))
+
+	for _, name := range []string{"AVGC", "MAXC", "FLAG"} {
+		if data, ok := taggs[name]; ok {
+			writeTagg(&buf, name, data)
+		}
+	}
+	writeTagg(&buf, "OFFS", make([]byte, 4*paaMaxMipmaps))
+	offsetTable := buf.Len() - 4*paaMaxMipmaps
+
+	// no palette
+	buf.Write([]byte{0, 0})
+
+	for i, mipmap := range mipmaps {
+		binary.LittleEndian.PutUint32(buf.Bytes()[offsetTable+4*i:], uint32(buf.Len()))
+
+		width, data := mipmap.Width, mipmap.Data
+		if compressed := compressLZO(data); len(compressed) < len(data) {
+			width, data = width|paaLZOFlag, compressed
+		}
+		if len(data) > 0xffffff {
+			return fmt.Errorf("mipmap %dx%d is too large", mipmap.Width, mipmap.Height)
+		}
+
+		buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(width)))
+		buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(mipmap.Height)))
+		buf.Write([]byte{byte(len(data)), byte(len(data) >> 8), byte(len(data) >> 16)})
+		buf.Write(data)
+	}
+
+	// a zero sized mipmap terminates the list
+	buf.Write(make([]byte, 6))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeTagg writes a tagg, whose signature and name are stored reversed
+// (AVGC is written as GGATCGVA).
+func writeTagg(buf *bytes.Buffer, name string, data []byte) {
+	buf.WriteString("GGAT")
+	for i := len(name) - 1; i >= 0; i-- {
+		buf.WriteByte(name[i])
+	}
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	buf.Write(data)
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Bounds().Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+func hasAlpha(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return true
+		}
+	}
+	return false
+}
+
+// downsample halves img in each dimension with a box filter.
+func downsample(img *image.NRGBA) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := max(1, bounds.Dx()/2), max(1, bounds.Dy()/2)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]int
+			for _, p := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				sx := min(2*x+p[0], bounds.Dx()-1)
+				sy := min(2*y+p[1], bounds.Dy()-1)
+				offset := img.PixOffset(sx, sy)
+				for k := 0; k < 4; k++ {
+					sum[k] += int(img.Pix[offset+k])
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				dst.Pix[offset+k] = uint8((sum[k] + 2) / 4)
+			}
+		}
+	}
+	return dst
+}
+
+// encodePAAFile converts the PNG or JPEG image at src to a PAA at dst.
+func encodePAAFile(src, dst string, profile TextureProfile) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("error decoding image %q: %w", src, err)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = EncodePAA(out, img, profile)
+	if err != nil {
+		return fmt.Errorf("error encoding %q: %w", dst, err)
+	}
+	return out.Close()
+}
+
+// DecodePAA reads the largest mipmap of a PAA texture. DXT1, DXT5 and the
+// uncompressed ARGB8888, ARGB4444, ARGB1555 and AI88 formats are supported.
+func DecodePAA(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, fmt.Errorf("paa is truncated")
+	}
+
+	format := binary.LittleEndian.Uint16(data)
+	pos := 2
+	for pos+12 <= len(data) && string(data[pos:pos+4]) == "GGAT" {
+		pos += 12 + int(binary.LittleEndian.Uint32(data[pos+8:]))
+	}
+	if pos+2 > len(data) {
+		return nil, fmt.Errorf("paa is truncated")
+	}
+	pos += 2 + 3*int(binary.LittleEndian.Uint16(data[pos:]))
+
+	if pos+7 > len(data) {
+		return nil, fmt.Errorf("paa has no mipmaps")
+	}
+	width := int(binary.LittleEndian.Uint16(data[pos:]))
+	height := int(binary.LittleEndian.Uint16(data[pos+2:]))
+	size := int(data[pos+4]) | int(data[pos+5])<<8 | int(data[pos+6])<<16
+	pos += 7
+	if pos+size > len(data) {
+		return nil, fmt.Errorf("paa mipmap is truncated")
+	}
+	mipmap := paaMipmap{Width: width &^ paaLZOFlag, Height: height, Data: data[pos : pos+size]}
+	if mipmap.Width == 0 || mipmap.Height == 0 {
+		return nil, fmt.Errorf("paa has no mipmaps")
+	}
+
+	switch format {
+	case paaDXT1, paaDXT5:
+		blocks := ((mipmap.Width + 3) / 4) * ((mipmap.Height + 3) / 4)
+		expected := blocks * 8
+		if format == paaDXT5 {
+			expected = blocks * 16
+		}
+		if width&paaLZOFlag != 0 {
+			mipmap.Data, err = decompressLZO(mipmap.Data, expected)
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing mipmap: %w", err)
+			}
+		}
+		if len(mipmap.Data) < expected {
+			return nil, fmt.Errorf("paa mipmap is truncated")
+		}
+		if format == paaDXT1 {
+			return decompressDXT1(mipmap.Width, mipmap.Height, mipmap.Data), nil
+		}
+		return decompressDXT5(mipmap.Width, mipmap.Height, mipmap.Data), nil
+	case paaARGB8888, paaARGB4444, paaARGB1555, paaAI88:
+		bytesPerPixel := 2
+		if format == paaARGB8888 {
+			bytesPerPixel = 4
+		}
+		expected := mipmap.Width * mipmap.Height * bytesPerPixel
+		if len(mipmap.Data) != expected {
+			mipmap.Data, _, err = decompressLZSS(mipmap.Data, expected)
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing mipmap: %w", err)
+			}
+		}
+		return decodeARGB(format, mipmap), nil
+	default:
+		return nil, fmt.Errorf("unsupported paa format %04x", format)
+	}
+}
+
+func decodeARGB(format uint16, mipmap paaMipmap) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, mipmap.Width, mipmap.Height))
+	for i := 0; i < mipmap.Width*mipmap.Height; i++ {
+		var r, g, b, a uint8
+		switch format {
+		case paaARGB8888:
+			b, g, r, a = mipmap.Data[4*i], mipmap.Data[4*i+1], mipmap.Data[4*i+2], mipmap.Data[4*i+3]
+		case paaARGB4444:
+			v := binary.LittleEndian.Uint16(mipmap.Data[2*i:])
+			a, r, g, b = uint8(v>>12)*0x11, uint8(v>>8&0xf)*0x11, uint8(v>>4&0xf)*0x11, uint8(v&0xf)*0x11
+		case paaARGB1555:
+			v := binary.LittleEndian.Uint16(mipmap.Data[2*i:])
+			expand := func(c uint16) uint8 { return uint8(c<<3 | c>>2) }
+			r, g, b = expand(v>>10&0x1f), expand(v>>5&0x1f), expand(v&0x1f)
+			a = uint8(v>>15) * 0xff
+		case paaAI88:
+			r, a = mipmap.Data[2*i], mipmap.Data[2*i+1]
+			g, b = r, r
+		}
+		copy(img.Pix[4*i:], []uint8{r, g, b, a})
+	}
+	return img
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newPAA2PNGCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build paa2png", flag.ExitOnError)
+	outputDir := flags.String("output", "", "Directory to write the PNG files to (defaults to next to each PAA)")
+
+	return &ffcli.Command{
+		Name:       "paa2png",
+		ShortUsage: "mod-build paa2png [options] <file.paa>...",
+		ShortHelp:  "Convert PAA textures to PNG",
+		LongHelp:   "Convert PAA textures to PNG. The largest mipmap of each texture is written.",
+		UsageFunc:  usage,
+		FlagSet:    flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				fmt.Fprintln(os.Stderr, "error: at least one paa file is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			for _, src := range args {
+				dst := swapExtension(src, ".png")
+				if *outputDir != "" {
+					dst = filepath.Join(*outputDir, filepath.Base(dst))
+				}
+				fmt.Printf("🔁 Converting : %q\n", src)
+				err := paaToPNG(src, dst)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func paaToPNG(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, err := DecodePAA(f)
+	if err != nil {
+		return fmt.Errorf("error decoding %q: %w", src, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = png.Encode(out, img)
+	if err != nil {
+		return fmt.Errorf("error encoding %q: %w", dst, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodePAA(t *testing.T) {
+	t.Run("stores opaque images as DXT1 with a full mipmap chain", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := EncodePAA(&buf, testImage(64, 32, 0xff), defaultTextureProfile)
+		require.NoError(t, err)
+
+		data := buf.Bytes()
+		assert.Equal(t, paaDXT1, binary.LittleEndian.Uint16(data))
+		assert.Contains(t, string(data), "GGATCGVA")
+		assert.Contains(t, string(data), "GGATCXAM")
+		assert.Contains(t, string(data), "GGATSFFO")
+		assert.NotContains(t, string(data), "GGATGALF")
+
+		sizes := testMipmapSizes(t, data)
+		assert.Equal(t, [][2]int{{64, 32}, {32, 16}, {16, 8}, {8, 4}}, sizes)
+	})
+
+	t.Run("stores images with alpha as DXT5", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := EncodePAA(&buf, testImage(16, 16, 0x80), defaultTextureProfile)
+		require.NoError(t, err)
+
+		data := buf.Bytes()
+		assert.Equal(t, paaDXT5, binary.LittleEndian.Uint16(data))
+		assert.Contains(t, string(data), "GGATGALF")
+		assert.Equal(t, [][2]int{{16, 16}, {8, 8}, {4, 4}}, testMipmapSizes(t, data))
+	})
+
+	t.Run("uses the profile format", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := EncodePAA(&buf, testImage(16, 16, 0x80), TextureProfile{Suffix: "_co", Format: "dxt1", Filter: "box"})
+		require.NoError(t, err)
+		assert.Equal(t, paaDXT1, binary.LittleEndian.Uint16(buf.Bytes()))
+		assert.NotContains(t, buf.String(), "GGATGALF")
+
+		buf.Reset()
+		err = EncodePAA(&buf, testImage(16, 16, 0xff), TextureProfile{Suffix: "_nohq", Format: "dxt5", Filter: "normalmap"})
+		require.NoError(t, err)
+		assert.Equal(t, paaDXT5, binary.LittleEndian.Uint16(buf.Bytes()))
+	})
+
+	t.Run("converts png files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		src := filepath.Join(tmpDir, "texture_co.png")
+		dst := filepath.Join(tmpDir, "texture_co.paa")
+
+		f, err := os.Create(src)
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(f, testImage(8, 8, 0xff)))
+		require.NoError(t, f.Close())
+
+		err = encodePAAFile(src, dst, defaultTextureProfile)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, paaDXT1, binary.LittleEndian.Uint16(data))
+	})
+}
+
+func TestDecodePAA(t *testing.T) {
+	t.Run("round trips DXT1 and DXT5 textures", func(t *testing.T) {
+		for _, alpha := range []uint8{0xff, 0x80} {
+			src := testImage(64, 64, alpha)
+
+			var buf bytes.Buffer
+			err := EncodePAA(&buf, src, defaultTextureProfile)
+			require.NoError(t, err)
+
+			img, err := DecodePAA(&buf)
+			require.NoError(t, err)
+			require.Equal(t, src.Bounds(), img.Bounds())
+
+			decoded := toNRGBA(img)
+			for i := range src.Pix {
+				assert.InDelta(t, src.Pix[i], decoded.Pix[i], 12, "channel %d of pixel %d", i%4, i/4)
+			}
+		}
+	})
+
+	t.Run("reads uncompressed and lzss compressed ARGB8888", func(t *testing.T) {
+		pixels := []byte{
+			0x10, 0x20, 0x30, 0x40, // BGRA
+			0x50, 0x60, 0x70, 0x80,
+		}
+
+		for _, data := range [][]byte{pixels, testLZSSLiterals(pixels)} {
+			paa := binary.LittleEndian.AppendUint16(nil, paaARGB8888)
+			paa = append(paa, 0, 0) // palette
+			paa = binary.LittleEndian.AppendUint16(paa, 2)
+			paa = binary.LittleEndian.AppendUint16(paa, 1)
+			paa = append(paa, byte(len(data)), 0, 0)
+			paa = append(paa, data...)
+			paa = append(paa, make([]byte, 6)...)
+
+			img, err := DecodePAA(bytes.NewReader(paa))
+			require.NoError(t, err)
+			assert.Equal(t, color.NRGBA{R: 0x30, G: 0x20, B: 0x10, A: 0x40}, img.At(0, 0))
+			assert.Equal(t, color.NRGBA{R: 0x70, G: 0x60, B: 0x50, A: 0x80}, img.At(1, 0))
+		}
+	})
+
+	t.Run("rejects lzo mipmaps larger than their data can expand to", func(t *testing.T) {
+		paa := binary.LittleEndian.AppendUint16(nil, paaDXT5)
+		paa = append(paa, 0, 0) // palette
+		paa = binary.LittleEndian.AppendUint16(paa, 0x7fff|paaLZOFlag)
+		paa = binary.LittleEndian.AppendUint16(paa, 0xffff)
+		paa = append(paa, 3, 0, 0, 0x11, 0, 0)
+		paa = append(paa, make([]byte, 6)...)
+
+		_, err := DecodePAA(bytes.NewReader(paa))
+		assert.ErrorContains(t, err, "corrupt lzo data")
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		_, err := DecodePAA(bytes.NewReader([]byte{0x34, 0x12, 0, 0, 4, 0, 4, 0, 0, 0, 0}))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported")
+	})
+}
+
+func TestCompressDXT(t *testing.T) {
+	t.Run("encodes solid blocks exactly", func(t *testing.T) {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		for i := 0; i < len(img.Pix); i += 4 {
+			copy(img.Pix[i:], []uint8{0xff, 0x00, 0x00, 0xff})
+		}
+
+		block := compressDXT1(img)
+		require.Len(t, block, 8)
+		assert.Equal(t, uint16(0xf800), binary.LittleEndian.Uint16(block[0:]))
+		assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(block[4:]))
+	})
+
+	t.Run("encodes alpha endpoints", func(t *testing.T) {
+		img := testImage(4, 4, 0x00)
+		img.Pix[3] = 0xff
+
+		block := compressDXT5(img)
+		require.Len(t, block, 16)
+		assert.Equal(t, uint8(0xff), block[0])
+		assert.Equal(t, uint8(0x00), block[1])
+	})
+}
+
+// testImage returns a gradient image with the given alpha.
+func testImage(width, height int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 0x40, A: alpha})
+		}
+	}
+	return img
+}
+
+// testMipmapSizes walks the taggs and mipmaps of a PAA and returns the size
+// of each mipmap.
+func testMipmapSizes(t *testing.T, data []byte) [][2]int {
+	t.Helper()
+
+	pos := 2
+	for string(data[pos:pos+4]) == "GGAT" {
+		pos += 12 + int(binary.LittleEndian.Uint32(data[pos+8:]))
+	}
+	pos += 2 + 3*int(binary.LittleEndian.Uint16(data[pos:]))
+
+	sizes := [][2]int{}
+	for {
+		require.LessOrEqual(t, pos+4, len(data))
+		width := int(binary.LittleEndian.Uint16(data[pos:]))
+		height := int(binary.LittleEndian.Uint16(data[pos+2:]))
+		if width == 0 && height == 0 {
+			return sizes
+		}
+		size := int(data[pos+4]) | int(data[pos+5])<<8 | int(data[pos+6])<<16
+		sizes = append(sizes, [2]int{width &^ paaLZOFlag, height})
+		pos += 7 + size
+	}
+}
+
+// testLZSSLiterals encodes data as LZSS without any back references.
+func testLZSSLiterals(data []byte) []byte {
+	out := []byte{}
+	var sum uint32
+	for i, b := range data {
+		if i%8 == 0 {
+			out = append(out, 0xff)
+		}
+		out = append(out, b)
+		sum += uint32(b)
+	}
+	return binary.LittleEndian.AppendUint32(out, sum)
+}
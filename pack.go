@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newPackCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build pack", flag.ExitOnError)
+	prefix := flags.String("prefix", "", "PBO prefix (defaults to the contents of "+prefixFile+")")
+	signKey := flags.String("sign", "", "Path to a .biprivatekey to sign the PBO with (optional)")
+	var passphrase passphraseSource
+	passphrase.register(flags)
+
+	return &ffcli.Command{
+		Name:       "pack",
+		ShortUsage: "mod-build pack [options] <directory> <output.pbo>",
+		ShortHelp:  "Pack a built addon directory into a PBO",
+		UsageFunc:  usage,
+		LongHelp: "Pack a built addon directory into a PBO. The files listed in the directory's\n" +
+			"build manifest are packed, or every file if there is no manifest.",
+		FlagSet: flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				fmt.Fprintln(os.Stderr, "error: directory and output file are required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return pack(args[0], args[1], *prefix, *signKey, passphrase)
+		},
+	}
+}
+
+func pack(directory, dst, prefix, signKey string, passphrase passphraseSource) error {
+	finfo, err := os.Stat(directory)
+	if err != nil {
+		return err
+	}
+	if !finfo.IsDir() {
+		return fmt.Errorf("error: path %q exists but is not a directory", directory)
+	}
+
+	output := NewOutput(directory)
+
+	manifest, err := output.LoadManifest()
+	if err != nil {
+		return err
+	}
+	if len(manifest) == 0 {
+		manifest, err = directoryManifest(directory)
+		if err != nil {
+			return err
+		}
+	}
+
+	if prefix == "" {
+		prefix, err = output.Prefix()
+		if err != nil {
+			return err
+		}
+	}
+
+	var key *BIPrivateKey
+	if signKey != "" {
+		key, err = readBIPrivateKeyFile(signKey, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("📦 Packing    : %q -> %q\n", directory, dst)
+	err = output.Pack(dst, prefix, manifest)
+	if err != nil || key == nil {
+		return err
+	}
+
+	fmt.Printf("✍️ Signing    : %q\n", dst)
+	_, err = signPBOFile(dst, key)
+	return err
+}
+
+// directoryManifest lists every file below root in a manifest without hashes,
+// for packing directories which were not produced by a build.
+func directoryManifest(root string) (Manifest, error) {
+	manifest := make(Manifest)
+	err := fs.WalkDir(os.DirFS(root), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == ".build.manifest" {
+			return nil
+		}
+		manifest[path] = ManifestEntry{SourcePath: path}
+		return nil
+	})
+	return manifest, err
+}
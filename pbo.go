@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	pboMethodUncompressed uint32 = 0x00000000
+	pboMethodCompressed   uint32 = 0x43707273 // "Cprs"
+	pboMethodVersion      uint32 = 0x56657273 // "Vers"
+)
+
+// PBOProperty is a key/value pair from the PBO header extension, such as
+// the addon prefix.
+type PBOProperty struct {
+	Key   string
+	Value string
+}
+
+// PBOEntry is a single file header from a PBO. Names are backslash
+// separated, as they are stored in the archive.
+type PBOEntry struct {
+	Name          string
+	PackingMethod uint32
+	OriginalSize  uint32
+	Reserved      uint32
+	Timestamp     uint32
+	DataSize      uint32
+}
+
+// pboName converts a slash separated relative path to a PBO entry name.
+func pboName(path string) string {
+	return strings.ReplaceAll(filepath.ToSlash(path), "/", `\`)
+}
+
+// PackPBO writes a PBO containing files, read relative to root, to w. Files
+// are stored uncompressed in the order given, followed by the SHA1 checksum
+// of everything written before it.
+func PackPBO(w io.Writer, root string, files []string, properties []PBOProperty) error {
+	entries := make([]PBOEntry, 0, len(files))
+	for _, file := range files {
+		finfo, err := os.Stat(filepath.Join(root, file))
+		if err != nil {
+			return fmt.Errorf("error reading file %q: %w", file, err)
+		}
+		if finfo.Size() > math.MaxUint32 {
+			return fmt.Errorf("file %q is too large to pack", file)
+		}
+		entries = append(entries, PBOEntry{
+			Name:          pboName(file),
+			PackingMethod: pboMethodUncompressed,
+			OriginalSize:  uint32(finfo.Size()),
+			Timestamp:     uint32(finfo.ModTime().Unix()),
+			DataSize:      uint32(finfo.Size()),
+		})
+	}
+
+	hash := sha1.New()
+	out := bufio.NewWriter(io.MultiWriter(w, hash))
+
+	err := writePBOHeader(out, properties, entries)
+	if err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		err = copyPBOData(out, filepath.Join(root, file), int64(entries[i].DataSize))
+		if err != nil {
+			return fmt.Errorf("error packing file %q: %w", file, err)
+		}
+	}
+
+	err = out.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append([]byte{0}, hash.Sum(nil)...))
+	return err
+}
+
+func writePBOHeader(w io.Writer, properties []PBOProperty, entries []PBOEntry) error {
+	err := writePBOEntry(w, PBOEntry{PackingMethod: pboMethodVersion})
+	if err != nil {
+		return err
+	}
+	for _, property := range properties {
+		_, err = fmt.Fprintf(w, "%s\x00%s\x00", property.Key, property.Value)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.Write([]byte{0})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = writePBOEntry(w, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	// an empty entry terminates the header
+	return writePBOEntry(w, PBOEntry{})
+}
+
+func writePBOEntry(w io.Writer, entry PBOEntry) error {
+	_, err := io.WriteString(w, entry.Name+"\x00")
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, []uint32{
+		entry.PackingMethod,
+		entry.OriginalSize,
+		entry.Reserved,
+		entry.Timestamp,
+		entry.DataSize,
+	})
+}
+
+func copyPBOData(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, size)
+	return err
+}
+
+// PBOReader provides access to the header and files of a PBO.
+type PBOReader struct {
+	Properties []PBOProperty
+	Entries    []PBOEntry
+
+	r       io.ReaderAt
+	offsets []int64
+	dataEnd int64
+}
+
+// NewPBOReader reads the PBO header from r.
+func NewPBOReader(r io.ReaderAt) (*PBOReader, error) {
+	counter := &countingReader{r: bufio.NewReader(io.NewSectionReader(r, 0, math.MaxInt64))}
+	pbo := &PBOReader{r: r}
+
+	for first := true; ; first = false {
+		entry, err := readPBOEntry(counter)
+		if err != nil {
+			return nil, fmt.Errorf("error reading pbo header: %w", err)
+		}
+		if entry.Name == "" {
+			if first && entry.PackingMethod == pboMethodVersion {
+				pbo.Properties, err = readPBOProperties(counter)
+				if err != nil {
+					return nil, fmt.Errorf("error reading pbo header: %w", err)
+				}
+				continue
+			}
+			break
+		}
+		pbo.Entries = append(pbo.Entries, entry)
+	}
+
+	offset := counter.n
+	for _, entry := range pbo.Entries {
+		pbo.offsets = append(pbo.offsets, offset)
+		offset += int64(entry.DataSize)
+	}
+	pbo.dataEnd = offset
+
+	// the data of every entry must be in the file, so a corrupt size in the
+	// header can't make ReadFile allocate more than the file holds
+	if pbo.dataEnd > 0 {
+		_, err := r.ReadAt(make([]byte, 1), pbo.dataEnd-1)
+		if err != nil {
+			return nil, fmt.Errorf("error reading pbo: the entries end past the end of the file: %w", err)
+		}
+	}
+
+	return pbo, nil
+}
+
+// Prefix returns the value of the prefix header property, if any.
+func (p *PBOReader) Prefix() string {
+	for _, property := range p.Properties {
+		if strings.EqualFold(property.Key, "prefix") {
+			return property.Value
+		}
+	}
+	return ""
+}
+
+// ReadFile returns the contents of the i-th entry, expanding compressed
+// entries.
+func (p *PBOReader) ReadFile(i int) ([]byte, error) {
+	entry := p.Entries[i]
+	data := make([]byte, entry.DataSize)
+	_, err := p.r.ReadAt(data, p.offsets[i])
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", entry.Name, err)
+	}
+
+	if entry.PackingMethod == pboMethodCompressed && entry.OriginalSize != entry.DataSize {
+		data, _, err = decompressLZSS(data, int(entry.OriginalSize))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing %q: %w", entry.Name, err)
+		}
+	}
+
+	return data, nil
+}
+
+// Checksum returns the SHA1 checksum stored at the end of the PBO.
+func (p *PBOReader) Checksum() ([]byte, error) {
+	trailer := make([]byte, 21)
+	_, err := p.r.ReadAt(trailer, p.dataEnd)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pbo checksum: %w", err)
+	}
+	return trailer[1:], nil
+}
+
+// ComputeChecksum calculates the SHA1 checksum of the PBO contents, which
+// should match Checksum for an intact file.
+func (p *PBOReader) ComputeChecksum() ([]byte, error) {
+	hash := sha1.New()
+	_, err := io.Copy(hash, io.NewSectionReader(p.r, 0, p.dataEnd))
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func readPBOEntry(r io.ByteReader) (PBOEntry, error) {
+	name, err := readCString(r)
+	if err != nil {
+		return PBOEntry{}, err
+	}
+	var fields [5]uint32
+	for i := range fields {
+		fields[i], err = readUint32(r)
+		if err != nil {
+			return PBOEntry{}, err
+		}
+	}
+	return PBOEntry{
+		Name:          name,
+		PackingMethod: fields[0],
+		OriginalSize:  fields[1],
+		Reserved:      fields[2],
+		Timestamp:     fields[3],
+		DataSize:      fields[4],
+	}, nil
+}
+
+func readPBOProperties(r io.ByteReader) ([]PBOProperty, error) {
+	properties := []PBOProperty{}
+	for {
+		key, err := readCString(r)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return properties, nil
+		}
+		value, err := readCString(r)
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, PBOProperty{Key: key, Value: value})
+	}
+}
+
+func readCString(r io.ByteReader) (string, error) {
+	var b strings.Builder
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == 0 {
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+	}
+}
+
+func readUint32(r io.ByteReader) (uint32, error) {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(c) << (8 * i)
+	}
+	return v, nil
+}
+
+// countingReader tracks the number of bytes read, so the end of the PBO
+// header can be found.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
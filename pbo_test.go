@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackPBO(t *testing.T) {
+	t.Run("writes header, data and checksum", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		writeOutputTestFile(t, tmpDir, "config.cpp", "class CfgPatches {};")
+		writeOutputTestFile(t, tmpDir, filepath.Join("data", "model.p3d"), "p3d")
+
+		var buf bytes.Buffer
+		err := PackPBO(&buf, tmpDir, []string{"config.cpp", "data/model.p3d"}, []PBOProperty{{Key: "prefix", Value: `WILDLANDZ\Anniversary`}})
+		require.NoError(t, err)
+
+		data := buf.Bytes()
+		require.Greater(t, len(data), 21)
+
+		body := data[:len(data)-21]
+		sum := sha1.Sum(body)
+		assert.Equal(t, byte(0), data[len(data)-21])
+		assert.Equal(t, sum[:], data[len(data)-20:])
+
+		r := bytes.NewReader(body)
+		name, entry := readTestPBOEntry(t, r)
+		assert.Equal(t, "", name)
+		assert.Equal(t, pboMethodVersion, entry[0])
+
+		assert.Equal(t, "prefix", readTestString(t, r))
+		assert.Equal(t, `WILDLANDZ\Anniversary`, readTestString(t, r))
+		assert.Equal(t, "", readTestString(t, r))
+
+		name, entry = readTestPBOEntry(t, r)
+		assert.Equal(t, "config.cpp", name)
+		assert.Equal(t, uint32(20), entry[4])
+
+		name, entry = readTestPBOEntry(t, r)
+		assert.Equal(t, `data\model.p3d`, name)
+		assert.Equal(t, uint32(3), entry[4])
+
+		name, entry = readTestPBOEntry(t, r)
+		assert.Equal(t, "", name)
+		assert.Equal(t, [5]uint32{}, entry)
+
+		rest := make([]byte, r.Len())
+		_, err = r.Read(rest)
+		require.NoError(t, err)
+		assert.Equal(t, "class CfgPatches {};p3d", string(rest))
+	})
+
+	t.Run("fails on missing files", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := PackPBO(&buf, t.TempDir(), []string{"missing.cpp"}, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing.cpp")
+	})
+}
+
+func TestOutput_Pack(t *testing.T) {
+	t.Run("does not pack the prefix file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		writeOutputTestFile(t, tmpDir, prefixFile, `WILDLANDZ\Anniversary`)
+		writeOutputTestFile(t, tmpDir, "config.cpp", "class CfgPatches {};")
+
+		output := NewOutput(tmpDir)
+		manifest := Manifest{
+			prefixFile:   {SourcePath: prefixFile},
+			"config.cpp": {SourcePath: "config.cpp"},
+		}
+
+		dst := filepath.Join(t.TempDir(), "addon.pbo")
+		err := output.Pack(dst, `WILDLANDZ\Anniversary`, manifest)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "config.cpp\x00")
+		assert.NotContains(t, string(data), prefixFile)
+	})
+}
+
+func TestPBOReader(t *testing.T) {
+	t.Run("reads back a packed pbo", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		writeOutputTestFile(t, tmpDir, "config.cpp", "class CfgPatches {};")
+		writeOutputTestFile(t, tmpDir, filepath.Join("data", "model.p3d"), "p3d")
+
+		var buf bytes.Buffer
+		err := PackPBO(&buf, tmpDir, []string{"config.cpp", "data/model.p3d"}, []PBOProperty{{Key: "prefix", Value: `WILDLANDZ\Anniversary`}})
+		require.NoError(t, err)
+
+		pbo, err := NewPBOReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+
+		assert.Equal(t, `WILDLANDZ\Anniversary`, pbo.Prefix())
+		require.Len(t, pbo.Entries, 2)
+		assert.Equal(t, "config.cpp", pbo.Entries[0].Name)
+		assert.Equal(t, `data\model.p3d`, pbo.Entries[1].Name)
+
+		data, err := pbo.ReadFile(1)
+		require.NoError(t, err)
+		assert.Equal(t, "p3d", string(data))
+
+		stored, err := pbo.Checksum()
+		require.NoError(t, err)
+		computed, err := pbo.ComputeChecksum()
+		require.NoError(t, err)
+		assert.Equal(t, stored, computed)
+	})
+
+	t.Run("expands compressed entries", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writePBOHeader(&buf, nil, []PBOEntry{{
+			Name:          "text.txt",
+			PackingMethod: pboMethodCompressed,
+			OriginalSize:  9,
+			DataSize:      10,
+		}})
+		require.NoError(t, err)
+		// "abc" as literals, then a back reference of 6 bytes at offset 3
+		buf.Write([]byte{0x07, 'a', 'b', 'c', 0x03, 0x03, 0x72, 0x03, 0x00, 0x00})
+
+		pbo, err := NewPBOReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+
+		data, err := pbo.ReadFile(0)
+		require.NoError(t, err)
+		assert.Equal(t, "abcabcabc", string(data))
+	})
+
+	t.Run("fails on entries past the end of the file", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writePBOHeader(&buf, nil, []PBOEntry{{Name: "a.txt", DataSize: 0xffffffff}})
+		require.NoError(t, err)
+		buf.WriteString("a")
+
+		_, err = NewPBOReader(bytes.NewReader(buf.Bytes()))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "past the end of the file")
+	})
+
+	t.Run("fails on impossible original sizes", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writePBOHeader(&buf, nil, []PBOEntry{{
+			Name:          "text.txt",
+			PackingMethod: pboMethodCompressed,
+			OriginalSize:  0xffffffff,
+			DataSize:      10,
+		}})
+		require.NoError(t, err)
+		buf.Write([]byte{0x07, 'a', 'b', 'c', 0x03, 0x03, 0x72, 0x03, 0x00, 0x00})
+
+		pbo, err := NewPBOReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+
+		_, err = pbo.ReadFile(0)
+		assert.ErrorIs(t, err, errLZSSCorrupt)
+	})
+
+	t.Run("reads pbos without a version entry", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writePBOEntry(&buf, PBOEntry{Name: "a.txt", DataSize: 1})
+		require.NoError(t, err)
+		err = writePBOEntry(&buf, PBOEntry{})
+		require.NoError(t, err)
+		buf.WriteString("a")
+
+		pbo, err := NewPBOReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+
+		assert.Empty(t, pbo.Properties)
+		require.Len(t, pbo.Entries, 1)
+		data, err := pbo.ReadFile(0)
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(data))
+	})
+}
+
+func readTestString(t *testing.T, r *bytes.Reader) string {
+	t.Helper()
+
+	s, err := readCString(r)
+	require.NoError(t, err)
+	return s
+}
+
+func readTestPBOEntry(t *testing.T, r *bytes.Reader) (string, [5]uint32) {
+	t.Helper()
+
+	name := readTestString(t, r)
+	var fields [5]uint32
+	err := binary.Read(r, binary.LittleEndian, &fields)
+	require.NoError(t, err)
+	return name, fields
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixFile = "$PBOPREFIX@.txt"
+
+// readPrefixFile returns the addon prefix stored in the file at path.
+func readPrefixFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	prefix, err := parsePrefix(string(contents))
+	if err != nil {
+		return "", fmt.Errorf("error reading %q: %w", path, err)
+	}
+	return prefix, nil
+}
+
+// parsePrefix returns the addon prefix from the contents of a prefix file.
+// The file either holds the prefix on its own, or key=value lines of which
+// one is prefix=<prefix>. Forward slashes are accepted as separators, and
+// leading and trailing separators are removed.
+func parsePrefix(contents string) (string, error) {
+	contents = strings.TrimPrefix(contents, "\ufeff")
+
+	lines := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var prefix string
+	if len(lines) > 0 && strings.Contains(lines[0], "=") {
+		found := false
+		for _, line := range lines {
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return "", fmt.Errorf("malformed prefix file line %q", line)
+			}
+			if strings.EqualFold(strings.TrimSpace(key), "prefix") {
+				prefix = strings.TrimSpace(value)
+				found = true
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("prefix file has no prefix= line")
+		}
+	} else {
+		if len(lines) > 1 {
+			return "", fmt.Errorf("prefix file has %d lines, expected 1", len(lines))
+		}
+		if len(lines) == 1 {
+			prefix = lines[0]
+		}
+	}
+
+	prefix = strings.Trim(strings.ReplaceAll(prefix, "/", `\`), `\`)
+	return prefix, validatePrefix(prefix)
+}
+
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("prefix is empty")
+	}
+	for _, component := range strings.Split(prefix, `\`) {
+		switch component {
+		case "":
+			return fmt.Errorf("prefix %q contains an empty path component", prefix)
+		case ".", "..":
+			return fmt.Errorf("prefix %q contains a relative path component", prefix)
+		}
+		if i := strings.IndexAny(component, `<>:"|?*`); i >= 0 {
+			return fmt.Errorf("prefix %q contains invalid character %q", prefix, component[i])
+		}
+		for _, r := range component {
+			if r < 0x20 {
+				return fmt.Errorf("prefix %q contains a control character", prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// prefixPath converts a prefix to a relative file system path.
+func prefixPath(prefix string) string {
+	return filepath.Join(strings.Split(prefix, `\`)...)
+}
+
+// prefixName converts a prefix to a name usable as a single file name, such
+// as the packed PBO (WILDLANDZ\Anniversary -> WILDLANDZ_Anniversary).
+func prefixName(prefix string) string {
+	return strings.ReplaceAll(prefix, `\`, "_")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "single component",
+			input: "WILDLANDZ_Anniversary",
+			want:  "WILDLANDZ_Anniversary",
+		},
+		{
+			name:  "nested prefix with trailing newline",
+			input: "WILDLANDZ\\Anniversary\r\n",
+			want:  `WILDLANDZ\Anniversary`,
+		},
+		{
+			name:  "leading and trailing separators are removed",
+			input: "\\WILDLANDZ\\Anniversary\\",
+			want:  `WILDLANDZ\Anniversary`,
+		},
+		{
+			name:  "forward slashes are converted",
+			input: "WILDLANDZ/Anniversary",
+			want:  `WILDLANDZ\Anniversary`,
+		},
+		{
+			name:  "byte order mark is ignored",
+			input: "\ufeffWILDLANDZ\\Anniversary",
+			want:  `WILDLANDZ\Anniversary`,
+		},
+		{
+			name:  "key/value variant",
+			input: "prefix=WILDLANDZ\\Anniversary\nversion=1.0\n",
+			want:  `WILDLANDZ\Anniversary`,
+		},
+		{
+			name:  "key/value variant with spaces",
+			input: "version = 1.0\nPrefix = WILDLANDZ\\Anniversary\n",
+			want:  `WILDLANDZ\Anniversary`,
+		},
+		{
+			name:    "empty file",
+			input:   "\n",
+			wantErr: true,
+		},
+		{
+			name:    "key/value variant without prefix",
+			input:   "version=1.0\n",
+			wantErr: true,
+		},
+		{
+			name:    "key/value variant with stray line",
+			input:   "prefix=WILDLANDZ\nWILDLANDZ\n",
+			wantErr: true,
+		},
+		{
+			name:    "multiple lines",
+			input:   "WILDLANDZ\nAnniversary\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty component",
+			input:   `WILDLANDZ\\Anniversary`,
+			wantErr: true,
+		},
+		{
+			name:    "relative component",
+			input:   `WILDLANDZ\..\Anniversary`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid character",
+			input:   `P:\WILDLANDZ`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePrefix(tt.input)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSource_Prefix(t *testing.T) {
+	t.Run("reads the prefix file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, prefixFile), []byte("WILDLANDZ\\Anniversary\n"), 0644)
+		require.NoError(t, err)
+
+		prefix, err := NewSource(tmpDir).Prefix()
+		require.NoError(t, err)
+		assert.Equal(t, `WILDLANDZ\Anniversary`, prefix)
+		assert.Equal(t, filepath.Join("WILDLANDZ", "Anniversary"), prefixPath(prefix))
+		assert.Equal(t, "WILDLANDZ_Anniversary", prefixName(prefix))
+	})
+
+	t.Run("returns an empty prefix when there is no prefix file", func(t *testing.T) {
+		prefix, err := NewSource(t.TempDir()).Prefix()
+		require.NoError(t, err)
+		assert.Equal(t, "", prefix)
+	})
+
+	t.Run("fails on a malformed prefix file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, prefixFile), []byte("\n"), 0644)
+		require.NoError(t, err)
+
+		_, err = NewSource(tmpDir).Prefix()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), prefixFile)
+	})
+}
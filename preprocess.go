@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth guards against files which include themselves.
+const maxIncludeDepth = 32
+
+// macro is a #define. Function-like macros have params, which may be empty
+// as in NAME().
+type macro struct {
+	function bool
+	params   []string
+	body     string
+}
+
+// Preprocessor expands #include, #define, #undef, #ifdef, #ifndef, #else and
+// #endif in configs, as the game's preprocessor does (without __EVAL and
+// __EXEC). Files are named by their slash separated path within root, and
+// the output contains #line markers so the config parser reports positions
+// in the original files.
+type Preprocessor struct {
+	root     string
+	prefix   string
+	defines  map[string]macro
+	included []string
+	// skipped are the includes of other addons which were warned about
+	skipped map[string]bool
+}
+
+// NewPreprocessor returns a Preprocessor for the files in root, an addon
+// source directory with the given prefix. Includes are resolved relative to
+// the including file, or to the prefix (\PREFIX\path\file.hpp). Includes
+// of files of other addons (\DZ\data\...) can't be resolved, and are
+// skipped with a warning.
+func NewPreprocessor(root, prefix string) *Preprocessor {
+	return &Preprocessor{root: root, prefix: prefix, defines: map[string]macro{}, skipped: map[string]bool{}}
+}
+
+// Define adds an object-like macro, as if the file started with
+// #define name body.
+func (p *Preprocessor) Define(name, body string) {
+	p.defines[name] = macro{body: body}
+}
+
+// Preprocess returns the preprocessed contents of the file at name, and the
+// names of the files it included. Macros defined in the file do not carry
+// over to the next call.
+func (p *Preprocessor) Preprocess(name string) ([]byte, []string, error) {
+	defines := maps.Clone(p.defines)
+	p.included = []string{}
+	defer func() {
+		p.defines = defines
+	}()
+
+	var out bytes.Buffer
+	err := p.include(&out, name, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Bytes(), p.included, nil
+}
+
+// condition is an #ifdef or #ifndef block.
+type condition struct {
+	pos    ConfigPos
+	active bool
+	inElse bool
+}
+
+func (p *Preprocessor) include(out *bytes.Buffer, name string, depth int) error {
+	data, err := os.ReadFile(filepath.Join(p.root, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	text, err := stripComments(name, strings.ReplaceAll(string(data), "\r\n", "\n"))
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	writeLineMarker(out, 1, name)
+	conditions := []condition{}
+	active := func() bool {
+		for _, c := range conditions {
+			if !c.active {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < len(lines); i++ {
+		pos := ConfigPos{File: name, Line: i + 1}
+		line := lines[i]
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			if active() {
+				// the arguments of a macro call may continue on the next lines
+				continued := 0
+				for p.unclosedMacroCall(line) && i+1 < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i+1]), "#") {
+					i++
+					continued++
+					line += " " + strings.TrimSpace(lines[i])
+				}
+				expanded, err := p.expand(line, map[string]bool{}, pos)
+				if err != nil {
+					return err
+				}
+				out.WriteString(expanded)
+				// keep the output in line with the source
+				out.WriteString(strings.Repeat("\n", continued))
+			}
+			out.WriteByte('\n')
+			continue
+		}
+
+		// directives continue onto the next line after a trailing backslash
+		directive := strings.TrimSpace(line)
+		continued := 0
+		for strings.HasSuffix(directive, `\`) && i+1 < len(lines) {
+			i++
+			continued++
+			directive = strings.TrimSuffix(directive, `\`) + " " + strings.TrimSpace(lines[i])
+		}
+		directive = strings.TrimSpace(directive[1:])
+		end := 0
+		for end < len(directive) && isIdentByte(directive[end]) {
+			end++
+		}
+		keyword, args := directive[:end], strings.TrimSpace(directive[end:])
+		included := false
+		errorf := func(format string, a ...any) error {
+			return &ConfigError{Pos: pos, Err: fmt.Sprintf(format, a...)}
+		}
+
+		switch keyword {
+		case "ifdef", "ifndef":
+			if args == "" {
+				return errorf("#%s requires a macro name", keyword)
+			}
+			_, defined := p.defines[args]
+			conditions = append(conditions, condition{pos: pos, active: defined == (keyword == "ifdef")})
+		case "else":
+			if len(conditions) == 0 || conditions[len(conditions)-1].inElse {
+				return errorf("#else without #ifdef or #ifndef")
+			}
+			c := &conditions[len(conditions)-1]
+			c.active, c.inElse = !c.active, true
+		case "endif":
+			if len(conditions) == 0 {
+				return errorf("#endif without #ifdef or #ifndef")
+			}
+			conditions = conditions[:len(conditions)-1]
+		case "define", "undef", "include":
+			if !active() {
+				break
+			}
+			switch keyword {
+			case "define":
+				name, m, err := parseDefine(args)
+				if err != nil {
+					return errorf("%v", err)
+				}
+				p.defines[name] = m
+			case "undef":
+				delete(p.defines, args)
+			case "include":
+				if depth >= maxIncludeDepth {
+					return errorf("#include nested too deeply (is %s including itself?)", name)
+				}
+				if len(args) < 2 || !(args[0] == '"' && args[len(args)-1] == '"' || args[0] == '<' && args[len(args)-1] == '>') {
+					return errorf(`#include expects "file" or <file>`)
+				}
+				target := args[1 : len(args)-1]
+				file, err := p.resolve(name, target)
+				if errors.Is(err, errExternalInclude) {
+					if !p.skipped[target] {
+						p.skipped[target] = true
+						fmt.Fprintf(os.Stderr, "⚠️ Skipping #include %q in %s:%d, it is not in this addon\n", target, name, i+1)
+					}
+					break
+				}
+				if err != nil {
+					return errorf("%v", err)
+				}
+				if !slices.Contains(p.included, file) {
+					p.included = append(p.included, file)
+				}
+				err = p.include(out, file, depth+1)
+				if err != nil {
+					return err
+				}
+				included = true
+			}
+		default:
+			if active() {
+				return errorf("unsupported preprocessor directive #%s", keyword)
+			}
+		}
+
+		if included {
+			writeLineMarker(out, i+2, name)
+			continue
+		}
+		// keep the output in line with the source
+		for j := 0; j <= continued; j++ {
+			out.WriteByte('\n')
+		}
+	}
+
+	if len(conditions) > 0 {
+		c := conditions[len(conditions)-1]
+		return &ConfigError{Pos: c.pos, Err: "#ifdef or #ifndef without #endif"}
+	}
+	return nil
+}
+
+func writeLineMarker(out *bytes.Buffer, line int, name string) {
+	fmt.Fprintf(out, "#line %d \"%s\"\n", line, name)
+}
+
+// parseDefine parses the arguments of #define NAME body or
+// #define NAME(a, b) body.
+func parseDefine(args string) (string, macro, error) {
+	end := 0
+	for end < len(args) && isIdentByte(args[end]) {
+		end++
+	}
+	name := args[:end]
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return "", macro{}, fmt.Errorf("#define requires a macro name")
+	}
+	if end == len(args) || args[end] != '(' {
+		return name, macro{body: strings.TrimSpace(args[end:])}, nil
+	}
+
+	params, body, ok := strings.Cut(args[end+1:], ")")
+	if !ok {
+		return "", macro{}, fmt.Errorf("missing ')' in parameters of macro %s", name)
+	}
+	m := macro{function: true, params: []string{}, body: strings.TrimSpace(body)}
+	if strings.TrimSpace(params) != "" {
+		for _, param := range strings.Split(params, ",") {
+			m.params = append(m.params, strings.TrimSpace(param))
+		}
+	}
+	return name, m, nil
+}
+
+// errExternalInclude is returned by resolve for absolute includes outside
+// the prefix of the addon, which belong to other addons.
+var errExternalInclude = errors.New("included file is in another addon")
+
+// resolve returns the name of the file included as file from the file at
+// from.
+func (p *Preprocessor) resolve(from, file string) (string, error) {
+	file = strings.ReplaceAll(file, `\`, "/")
+	candidates := []string{}
+	if !strings.HasPrefix(file, "/") {
+		candidates = append(candidates, path.Join(path.Dir(from), file))
+	}
+	trimmed := strings.TrimPrefix(file, "/")
+	prefix := strings.ReplaceAll(p.prefix, `\`, "/") + "/"
+	inPrefix := p.prefix != "" && len(trimmed) > len(prefix) && strings.EqualFold(trimmed[:len(prefix)], prefix)
+	if inPrefix {
+		candidates = append(candidates, path.Clean(trimmed[len(prefix):]))
+	}
+
+	for _, candidate := range candidates {
+		if candidate == ".." || strings.HasPrefix(candidate, "../") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(p.root, filepath.FromSlash(candidate))); err == nil {
+			return candidate, nil
+		}
+	}
+	if strings.HasPrefix(file, "/") && !inPrefix {
+		return "", errExternalInclude
+	}
+	return "", fmt.Errorf("included file %q not found", file)
+}
+
+// stripComments replaces comments with spaces, keeping the line breaks of
+// block comments.
+func stripComments(name, text string) (string, error) {
+	var out strings.Builder
+	line := 1
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"':
+			end := strings.IndexAny(text[i+1:], "\"\n")
+			if end < 0 || text[i+1+end] == '\n' {
+				// unterminated strings are reported by the parser
+				out.WriteByte(c)
+				continue
+			}
+			out.WriteString(text[i : i+end+2])
+			i += end + 1
+		case strings.HasPrefix(text[i:], "//"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				return out.String(), nil
+			}
+			i += end - 1
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return "", &ConfigError{Pos: ConfigPos{File: name, Line: line}, Err: "unterminated comment"}
+			}
+			comment := text[i : i+end+4]
+			newlines := strings.Count(comment, "\n")
+			line += newlines
+			out.WriteString(strings.Repeat("\n", newlines))
+			if newlines == 0 {
+				out.WriteByte(' ')
+			}
+			i += len(comment) - 1
+		default:
+			if c == '\n' {
+				line++
+			}
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
+
+// expand expands the macros in text, except those in disabled, which are
+// being expanded already. Quoted strings are left as they are.
+func (p *Preprocessor) expand(text string, disabled map[string]bool, pos ConfigPos) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				out.WriteString(text[i:])
+				return out.String(), nil
+			}
+			out.WriteString(text[i : i+end+2])
+			i += end + 2
+			continue
+		case c >= '0' && c <= '9':
+			// numbers such as 1e5 are not identifiers
+			j := i
+			for j < len(text) && (isIdentByte(text[j]) || text[j] == '.') {
+				j++
+			}
+			out.WriteString(text[i:j])
+			i = j
+			continue
+		case !isIdentByte(c):
+			out.WriteByte(c)
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(text) && isIdentByte(text[j]) {
+			j++
+		}
+		name := text[i:j]
+		m, ok := p.defines[name]
+		switch {
+		case name == "__LINE__":
+			out.WriteString(strconv.Itoa(pos.Line))
+			i = j
+			continue
+		case name == "__FILE__":
+			out.WriteString(`"` + pos.File + `"`)
+			i = j
+			continue
+		case !ok || disabled[name]:
+			out.WriteString(name)
+			i = j
+			continue
+		}
+
+		args := []string{}
+		if m.function {
+			open := j
+			for open < len(text) && (text[open] == ' ' || text[open] == '\t') {
+				open++
+			}
+			if open == len(text) || text[open] != '(' {
+				// a function-like macro name without arguments is left alone
+				out.WriteString(name)
+				i = j
+				continue
+			}
+			var err error
+			args, j, err = macroArgs(text, open)
+			if err != nil {
+				return "", &ConfigError{Pos: pos, Err: fmt.Sprintf("%v in arguments of macro %s", err, name)}
+			}
+			if len(m.params) == 0 && len(args) == 1 && args[0] == "" {
+				args = nil
+			}
+			if len(args) != len(m.params) {
+				return "", &ConfigError{Pos: pos, Err: fmt.Sprintf("macro %s expects %d arguments, found %d", name, len(m.params), len(args))}
+			}
+		}
+
+		nested := map[string]bool{name: true}
+		for disabledName := range disabled {
+			nested[disabledName] = true
+		}
+		expanded, err := p.expand(substitute(m, args), nested, pos)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(expanded)
+		i = j
+	}
+	return out.String(), nil
+}
+
+// unclosedMacroCall reports whether text ends inside the arguments of a call
+// of a function-like macro.
+func (p *Preprocessor) unclosedMacroCall(text string) bool {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return false
+			}
+			i += end + 2
+			continue
+		case !isIdentByte(c) || c >= '0' && c <= '9':
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(text) && isIdentByte(text[j]) {
+			j++
+		}
+		if m, ok := p.defines[text[i:j]]; ok && m.function {
+			open := j
+			for open < len(text) && (text[open] == ' ' || text[open] == '\t') {
+				open++
+			}
+			if open < len(text) && text[open] == '(' {
+				_, end, err := macroArgs(text, open)
+				if errors.Is(err, errMissingParen) {
+					return true
+				}
+				if err == nil {
+					j = end
+				}
+			}
+		}
+		i = j
+	}
+	return false
+}
+
+// errMissingParen is returned by macroArgs for calls without a closing
+// parenthesis.
+var errMissingParen = errors.New("missing ')'")
+
+// macroArgs splits the arguments of a macro call, starting at the opening
+// parenthesis at open, and returns them with the index after the closing
+// parenthesis. Commas in nested parentheses, braces or quotes do not split
+// arguments.
+func macroArgs(text string, open int) ([]string, int, error) {
+	args := []string{}
+	depth := 0
+	start := open + 1
+	for i := open + 1; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, 0, fmt.Errorf("unterminated string")
+			}
+			i += end + 1
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			if depth == 0 {
+				if text[i] != ')' {
+					return nil, 0, fmt.Errorf("unexpected %q", text[i])
+				}
+				return append(args, strings.TrimSpace(text[start:i])), i + 1, nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(text[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return nil, 0, errMissingParen
+}
+
+// substitute replaces the parameters in the body of m with args, applying
+// the # (stringify) and ## (concatenate) operators.
+func substitute(m macro, args []string) string {
+	values := map[string]string{}
+	for i, param := range m.params {
+		values[param] = args[i]
+	}
+
+	body := m.body
+	var out strings.Builder
+	for i := 0; i < len(body); {
+		c := body[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(body[i+1:], '"')
+			if end < 0 {
+				out.WriteString(body[i:])
+				return out.String()
+			}
+			out.WriteString(body[i : i+end+2])
+			i += end + 2
+		case strings.HasPrefix(body[i:], "##"):
+			trimmed := strings.TrimRight(out.String(), " \t")
+			out.Reset()
+			out.WriteString(trimmed)
+			i += 2
+			for i < len(body) && (body[i] == ' ' || body[i] == '\t') {
+				i++
+			}
+		case c == '#':
+			j := i + 1
+			for j < len(body) && (body[j] == ' ' || body[j] == '\t') {
+				j++
+			}
+			k := j
+			for k < len(body) && isIdentByte(body[k]) {
+				k++
+			}
+			if value, ok := values[body[j:k]]; ok && k > j {
+				out.WriteString(`"` + value + `"`)
+				i = k
+			} else {
+				out.WriteByte(c)
+				i++
+			}
+		case isIdentByte(c):
+			j := i
+			for j < len(body) && isIdentByte(body[j]) {
+				j++
+			}
+			if value, ok := values[body[i:j]]; ok {
+				out.WriteString(value)
+			} else {
+				out.WriteString(body[i:j])
+			}
+			i = j
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
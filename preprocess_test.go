@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreprocessor(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			"object-like macros",
+			map[string]string{"config.cpp": "#define SCOPE 2\nscope = SCOPE;\nname = \"SCOPE\";\n"},
+			"\nscope = 2;\nname = \"SCOPE\";\n",
+		},
+		{
+			"function-like macros with # and ##",
+			map[string]string{"config.cpp": "#define TEXTURE(name, suffix) \\\n\t#name##_##suffix\n#define PATH(file) \\WILDLANDZ\\data\\##file\ntexture = TEXTURE(cupcake, co);\nmodel = PATH(cupcake.p3d);\n"},
+			"\n\n\ntexture = \"cupcake\"_co;\nmodel = \\WILDLANDZ\\data\\cupcake.p3d;\n",
+		},
+		{
+			"nested macros and arguments",
+			map[string]string{"config.cpp": "#define ADD(a, b) {a, b}\n#define ONE 1\n#define PAIR ADD(ONE, {2, 3})\nvalues[] = PAIR;\n"},
+			"\n\n\nvalues[] = {1, {2, 3}};\n",
+		},
+		{
+			"self referencing macros are not expanded again",
+			map[string]string{"config.cpp": "#define LOOP LOOP + 1\nx = LOOP;\n"},
+			"\nx = LOOP + 1;\n",
+		},
+		{
+			"conditionals",
+			map[string]string{"config.cpp": "#define DEBUG\n#ifdef DEBUG\na = 1;\n#else\na = 2;\n#endif\n#ifndef DEBUG\nb = 1;\n#endif\n#undef DEBUG\n#ifdef DEBUG\nc = 1;\n#endif\n"},
+			"\n\na = 1;\n\n\n\n\n\n\n\n\n\n\n",
+		},
+		{
+			"comments are stripped",
+			map[string]string{"config.cpp": "a = 1; // #define\n/* #define X\n*/ b = \"// kept\";\n"},
+			"a = 1; \n\n b = \"// kept\";\n",
+		},
+		{
+			"includes relative to the file and to the prefix",
+			map[string]string{
+				"gear/config.cpp":      "#include \"data\\macros.hpp\"\n#include <\\WILDLANDZ\\Anniversary\\common.hpp>\nx = VALUE;\n",
+				"gear/data/macros.hpp": "#define VALUE COMMON\n",
+				"common.hpp":           "#define COMMON 42\n",
+			},
+			"#line 1 \"gear/data/macros.hpp\"\n\n#line 2 \"gear/config.cpp\"\n#line 1 \"common.hpp\"\n\n#line 3 \"gear/config.cpp\"\nx = 42;\n",
+		},
+		{
+			"macro arguments over several lines",
+			map[string]string{"config.cpp": "#define ADD(a, b) {a, b}\nvalues[] = ADD(1,\n\t{2, 3});\nx = 4;\n"},
+			"\nvalues[] = {1, {2, 3}};\n\nx = 4;\n",
+		},
+		{
+			"includes of other addons are skipped",
+			map[string]string{"config.cpp": "#include \"\\DZ\\data\\basicDefines.hpp\"\nx = 1;\n"},
+			"\nx = 1;\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := testFiles(t, test.files)
+			name := "config.cpp"
+			if _, ok := test.files["gear/config.cpp"]; ok {
+				name = "gear/config.cpp"
+			}
+
+			out, _, err := NewPreprocessor(root, `WILDLANDZ\Anniversary`).Preprocess(name)
+			require.NoError(t, err)
+			assert.Equal(t, "#line 1 \""+name+"\"\n"+test.expected, string(out))
+		})
+	}
+
+	t.Run("returns the included files", func(t *testing.T) {
+		root := testFiles(t, map[string]string{
+			"config.cpp":       "#include \"macros.hpp\"\n#include \"data/classes.hpp\"\n#include \"macros.hpp\"\n",
+			"macros.hpp":       "",
+			"data/classes.hpp": "#include \"../macros.hpp\"\n",
+		})
+		_, included, err := NewPreprocessor(root, "").Preprocess("config.cpp")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"macros.hpp", "data/classes.hpp"}, included)
+	})
+
+	t.Run("defines do not carry over between files", func(t *testing.T) {
+		root := testFiles(t, map[string]string{"a.cpp": "#define A 1\n", "b.cpp": "x = A;\n"})
+		preprocessor := NewPreprocessor(root, "")
+		preprocessor.Define("B", "2")
+		_, _, err := preprocessor.Preprocess("a.cpp")
+		require.NoError(t, err)
+
+		out, _, err := preprocessor.Preprocess("b.cpp")
+		require.NoError(t, err)
+		assert.Equal(t, "#line 1 \"b.cpp\"\nx = A;\n", string(out))
+		assert.Equal(t, macro{body: "2"}, preprocessor.defines["B"])
+	})
+
+	t.Run("parse errors refer to the original files", func(t *testing.T) {
+		root := testFiles(t, map[string]string{
+			"config.cpp":  "// header\n#include \"classes.hpp\"\n\nclass B {}\n",
+			"classes.hpp": "#define SCOPE 2\nclass A { scope = SCOPE; };\n",
+		})
+		out, _, err := NewPreprocessor(root, "").Preprocess("config.cpp")
+		require.NoError(t, err)
+
+		_, err = ParseConfig("config.cpp", out)
+		assert.EqualError(t, err, "config.cpp:5: expected ';' after class B, found end of file")
+
+		root = testFiles(t, map[string]string{
+			"config.cpp":  "#include \"classes.hpp\"\n",
+			"classes.hpp": "\nclass A { scope = ; };\n",
+		})
+		out, _, err = NewPreprocessor(root, "").Preprocess("config.cpp")
+		require.NoError(t, err)
+		_, err = ParseConfig("config.cpp", out)
+		assert.EqualError(t, err, `classes.hpp:2: expected a value, found ";"`)
+	})
+
+	t.Run("missing includes in the prefix are errors", func(t *testing.T) {
+		root := testFiles(t, map[string]string{"config.cpp": "#include \"\\WILDLANDZ\\Anniversary\\missing.hpp\"\n"})
+		_, _, err := NewPreprocessor(root, `WILDLANDZ\Anniversary`).Preprocess("config.cpp")
+		assert.EqualError(t, err, `config.cpp:1: included file "/WILDLANDZ/Anniversary/missing.hpp" not found`)
+	})
+
+	errorTests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{"missing include", "\n#include \"missing.hpp\"\n", `config.cpp:2: included file "missing.hpp" not found`},
+		{"include outside the source", "#include \"../secret.hpp\"\n", `config.cpp:1: included file "../secret.hpp" not found`},
+		{"include of itself", "#include \"config.cpp\"\n", "#include nested too deeply"},
+		{"unterminated ifdef", "#ifdef A\n", "config.cpp:1: #ifdef or #ifndef without #endif"},
+		{"endif without ifdef", "\n#endif\n", "config.cpp:2: #endif without #ifdef or #ifndef"},
+		{"unsupported directive", "#if 1\n", "config.cpp:1: unsupported preprocessor directive #if"},
+		{"wrong number of arguments", "#define F(a, b) a\nx = F(1);\n", "config.cpp:2: macro F expects 2 arguments, found 1"},
+		{"unterminated arguments", "#define F(a) a\nx = F(1;\n", "config.cpp:2: missing ')' in arguments of macro F"},
+	}
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			root := testFiles(t, map[string]string{"config.cpp": test.config})
+			_, _, err := NewPreprocessor(root, "").Preprocess("config.cpp")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		})
+	}
+}
+
+// testFiles writes files, keyed by their slash separated path, to a
+// temporary directory and returns it.
+func testFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+	return root
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rapSignature starts a rapified (binarized) config.
+const rapSignature = "\x00raP"
+
+// Rapify writes config to w in the rapified format read by the game, as
+// config.bin. The header is followed by the root class body. Class entries
+// point to their bodies, which are written depth first after the entries of
+// the class containing them. The enum table comes last.
+func Rapify(w io.Writer, config *Config) error {
+	var buf bytes.Buffer
+	buf.WriteString(rapSignature)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, 0))
+	buf.Write(binary.LittleEndian.AppendUint32(nil, 8))
+	enumOffset := buf.Len()
+	buf.Write(binary.LittleEndian.AppendUint32(nil, 0))
+
+	err := writeRapClass(&buf, config.Root)
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(buf.Bytes()[enumOffset:], uint32(buf.Len()))
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(config.Enums))))
+	for _, enum := range config.Enums {
+		writeRapString(&buf, enum.Name)
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(enum.Value)))
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func writeRapClass(buf *bytes.Buffer, class *ConfigClass) error {
+	writeRapString(buf, class.Base)
+	writeCompressedInt(buf, len(class.Entries))
+
+	// offsets of the class entries, patched once their bodies are written
+	offsets := map[*ConfigClass]int{}
+	for _, entry := range class.Entries {
+		buf.WriteByte(byte(entry.Kind))
+		switch entry.Kind {
+		case ConfigClassEntry:
+			writeRapString(buf, entry.Name)
+			offsets[entry.Class] = buf.Len()
+			buf.Write(binary.LittleEndian.AppendUint32(nil, 0))
+		case ConfigValueEntry:
+			buf.WriteByte(byte(entry.Value.Type))
+			writeRapString(buf, entry.Name)
+			writeRapScalar(buf, entry.Value)
+		case ConfigArrayEntry:
+			writeRapString(buf, entry.Name)
+			writeRapArray(buf, entry.Value)
+		case ConfigAppendEntry:
+			buf.Write(binary.LittleEndian.AppendUint32(nil, 1))
+			writeRapString(buf, entry.Name)
+			writeRapArray(buf, entry.Value)
+		case ConfigExternEntry, ConfigDeleteEntry:
+			writeRapString(buf, entry.Name)
+		default:
+			return fmt.Errorf("%s: unknown entry kind %d", entry.Pos, entry.Kind)
+		}
+	}
+
+	for _, entry := range class.Entries {
+		if entry.Kind != ConfigClassEntry {
+			continue
+		}
+		binary.LittleEndian.PutUint32(buf.Bytes()[offsets[entry.Class]:], uint32(buf.Len()))
+		err := writeRapClass(buf, entry.Class)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRapScalar(buf *bytes.Buffer, value ConfigValue) {
+	switch value.Type {
+	case ConfigString:
+		writeRapString(buf, value.String)
+	case ConfigFloat:
+		buf.Write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(value.Float)))
+	case ConfigInt:
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(value.Int)))
+	case ConfigArray:
+		writeRapArray(buf, value)
+	}
+}
+
+func writeRapArray(buf *bytes.Buffer, array ConfigValue) {
+	writeCompressedInt(buf, len(array.Array))
+	for _, value := range array.Array {
+		buf.WriteByte(byte(value.Type))
+		writeRapScalar(buf, value)
+	}
+}
+
+func writeRapString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+}
+
+// writeCompressedInt writes n seven bits at a time, lowest first, with the
+// high bit set on every byte but the last.
+func writeCompressedInt(buf *bytes.Buffer, n int) {
+	for n >= 0x80 {
+		buf.WriteByte(byte(n&0x7f | 0x80))
+		n >>= 7
+	}
+	buf.WriteByte(byte(n))
+}
+
+// isRapifiable reports whether path is a config which is rapified to
+// config.bin when rapifying is enabled.
+func isRapifiable(path string) bool {
+	return strings.EqualFold(filepath.Base(path), "config.cpp")
+}
+
+// rapifiedPath returns the output path of a rapified config.
+func rapifiedPath(path string) string {
+	return swapExtension(path, ".bin")
+}
+
+// rapifyFile preprocesses and parses the config at name and writes it
+// rapified to dst. References to converted images are rewritten if rewriter
+// is not nil. It returns the files the output depends on: the files
+// included by the config and the images whose references were rewritten.
+func rapifyFile(preprocessor *Preprocessor, rewriter *imageRewriter, name, dst string) ([]string, error) {
+	data, included, err := preprocessor.Preprocess(name)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(name, data)
+	if err != nil {
+		return nil, err
+	}
+	if rewriter != nil {
+		included = append(included, rewriter.RewriteConfig(config.Root)...)
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	err = Rapify(out, config)
+	if err != nil {
+		return nil, fmt.Errorf("error rapifying %q: %w", name, err)
+	}
+	return included, out.Close()
+}
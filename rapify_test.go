@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRapify(t *testing.T) {
+	t.Run("writes the rapified format", func(t *testing.T) {
+		config, err := ParseConfig("config.cpp", []byte(`
+enum { K = 3 };
+class A: B
+{
+	x = 1;
+	s = "a";
+	f[] = {1.5};
+	class C;
+	delete D;
+	a[] += {"b"};
+	class E {};
+};
+`))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, Rapify(&buf, config))
+
+		expected := []byte{
+			0x00, 'r', 'a', 'P', 0, 0, 0, 0, 8, 0, 0, 0, 77, 0, 0, 0,
+			// root
+			0, 1,
+			0, 'A', 0, 25, 0, 0, 0,
+			// A
+			'B', 0, 7,
+			1, 2, 'x', 0, 1, 0, 0, 0,
+			1, 0, 's', 0, 'a', 0,
+			2, 'f', 0, 1, 1, 0x00, 0x00, 0xc0, 0x3f,
+			3, 'C', 0,
+			4, 'D', 0,
+			5, 1, 0, 0, 0, 'a', 0, 1, 0, 'b', 0,
+			0, 'E', 0, 75, 0, 0, 0,
+			// E
+			0, 0,
+			// enums
+			1, 0, 0, 0, 'K', 0, 3, 0, 0, 0,
+		}
+		assert.Equal(t, expected, buf.Bytes())
+	})
+
+	t.Run("writes compressed counts", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeCompressedInt(&buf, 300)
+		assert.Equal(t, []byte{0xac, 0x02}, buf.Bytes())
+	})
+
+	t.Run("rapifies files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "gear"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "gear", "config.cpp"), []byte("class CfgPatches {};\n"), 0644))
+
+		output := NewOutput(filepath.Join(tmpDir, "output"))
+		outputPath, hash, _, err := output.Rapify(NewPreprocessor(tmpDir, ""), nil, "gear/config.cpp")
+		require.NoError(t, err)
+		assert.Equal(t, "gear/config.bin", outputPath)
+		assert.NotEmpty(t, hash)
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, "output", "gear", "config.bin"))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data, []byte(rapSignature)))
+	})
+
+	t.Run("reports parse errors with the source path", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "gear"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "gear", "config.cpp"), []byte("class CfgPatches {}\n"), 0644))
+
+		_, _, _, err := NewOutput(filepath.Join(tmpDir, "output")).Rapify(NewPreprocessor(tmpDir, ""), nil, "gear/config.cpp")
+		assert.ErrorContains(t, err, "gear/config.cpp:2: expected ';' after class CfgPatches")
+	})
+}
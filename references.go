@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// referenceExtensions are the extensions of the asset paths which are
+// checked in configs, materials and layouts.
+var referenceExtensions = []string{
+	".anm",
+	".bisurf",
+	".edds",
+	".emat",
+	".fnt",
+	".imageset",
+	".jpg",
+	".layout",
+	".ogg",
+	".p3d",
+	".paa",
+	".pac",
+	".png",
+	".ptc",
+	".rtm",
+	".rvmat",
+	".tga",
+	".wav",
+	".wss",
+}
+
+// defaultReferenceAllow are the prefixes of references to vanilla assets,
+// which are not part of the output.
+var defaultReferenceAllow = []string{`DZ\`}
+
+// isReferenceSource reports whether path is a file whose asset references
+// are checked.
+func isReferenceSource(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".rvmat", ".layout":
+		return true
+	}
+	return isRapifiable(path)
+}
+
+// isAssetPath reports whether s looks like the path of an asset.
+func isAssetPath(s string) bool {
+	return strings.ContainsAny(s, `\/`) && slices.Contains(referenceExtensions, strings.ToLower(filepath.Ext(s)))
+}
+
+// AssetReference is the path of an asset referenced from a config, material
+// or layout.
+type AssetReference struct {
+	Path string
+	Pos  ConfigPos
+}
+
+// referencePrefixes is a list of reference path prefixes, given by a
+// repeated flag.
+type referencePrefixes []string
+
+func (r *referencePrefixes) String() string {
+	if r == nil {
+		return ""
+	}
+	return strings.Join(*r, ", ")
+}
+
+func (r *referencePrefixes) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// findReferences returns the asset references in the file at path in the
+// source. Configs are preprocessed, so references in included files and
+// macros are found too.
+func findReferences(source *Source, preprocessor *Preprocessor, path string) ([]AssetReference, error) {
+	if isRapifiable(path) {
+		config, err := loadConfig(preprocessor, path)
+		if err != nil {
+			return nil, err
+		}
+		return configReferences(config.Root), nil
+	}
+
+	data, err := os.ReadFile(source.RealPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".layout") {
+		return layoutReferences(path, data), nil
+	}
+
+	var config *Config
+	if bytes.HasPrefix(data, []byte(rapSignature)) {
+		config, err = Derapify(data)
+		if err == nil {
+			setConfigFile(config.Root, path)
+		}
+	} else {
+		config, err = ParseConfig(path, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", path, err)
+	}
+	return configReferences(config.Root), nil
+}
+
+// configReferences returns the asset paths in the values of class and the
+// classes it contains.
+func configReferences(class *ConfigClass) []AssetReference {
+	var references []AssetReference
+	var values func(value ConfigValue, pos ConfigPos)
+	values = func(value ConfigValue, pos ConfigPos) {
+		switch value.Type {
+		case ConfigString:
+			if isAssetPath(value.String) {
+				references = append(references, AssetReference{Path: value.String, Pos: pos})
+			}
+		case ConfigArray:
+			for _, element := range value.Array {
+				values(element, pos)
+			}
+		}
+	}
+
+	for _, entry := range class.Entries {
+		switch entry.Kind {
+		case ConfigClassEntry:
+			references = append(references, configReferences(entry.Class)...)
+		case ConfigValueEntry, ConfigArrayEntry, ConfigAppendEntry:
+			values(entry.Value, entry.Pos)
+		}
+	}
+	return references
+}
+
+var layoutStringPattern = regexp.MustCompile(`"([^"]*)"`)
+
+// layoutReferences returns the asset paths in the quoted strings of a
+// layout.
+func layoutReferences(name string, data []byte) []AssetReference {
+	var references []AssetReference
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		for _, match := range layoutStringPattern.FindAllStringSubmatch(scanner.Text(), -1) {
+			if isAssetPath(match[1]) {
+				references = append(references, AssetReference{Path: match[1], Pos: ConfigPos{File: name, Line: line}})
+			}
+		}
+	}
+	return references
+}
+
+// referenceChecker resolves asset references against the output. Paths in
+// the addon's prefix must be among its outputs, paths elsewhere must exist
+// below the output root, and paths with an allowed prefix are not checked.
+type referenceChecker struct {
+	prefix     string
+	outputs    map[string]bool
+	outputRoot string
+	allow      []string
+}
+
+func newReferenceChecker(prefix string, manifest Manifest, outputRoot string, allow []string) *referenceChecker {
+	checker := &referenceChecker{
+		prefix:     normalizeReference(prefix),
+		outputs:    map[string]bool{},
+		outputRoot: outputRoot,
+	}
+	for path, entry := range manifest {
+		if entry.OutputPath != "" {
+			path = entry.OutputPath
+		}
+		checker.outputs[strings.ToLower(path)] = true
+	}
+	for _, prefix := range append(slices.Clone(defaultReferenceAllow), allow...) {
+		checker.allow = append(checker.allow, normalizeReference(prefix))
+	}
+	return checker
+}
+
+// normalizeReference returns a reference path in lower case, with
+// backslashes and without a leading separator, for comparing paths.
+func normalizeReference(path string) string {
+	return strings.ToLower(strings.TrimLeft(strings.ReplaceAll(path, "/", `\`), `\`))
+}
+
+// Check returns why reference is broken, or an empty string if it is not.
+func (c *referenceChecker) Check(reference string) string {
+	path := normalizeReference(reference)
+	for _, allow := range c.allow {
+		if strings.HasPrefix(path, allow) {
+			return ""
+		}
+	}
+
+	if c.prefix != "" && strings.HasPrefix(path, c.prefix+`\`) {
+		output := strings.ReplaceAll(strings.TrimPrefix(path, c.prefix+`\`), `\`, "/")
+		if c.outputs[output] {
+			return ""
+		}
+		if shouldConvert(output) && c.outputs[swapExtension(output, ".paa")] {
+			return fmt.Sprintf("%s is converted to .paa, reference the .paa instead", reference)
+		}
+		return fmt.Sprintf("%s is not in the addon", reference)
+	}
+
+	parts := strings.Split(strings.TrimLeft(strings.ReplaceAll(reference, "/", `\`), `\`), `\`)
+	_, err := os.Stat(filepath.Join(append([]string{c.outputRoot}, parts...)...))
+	if err != nil {
+		return fmt.Sprintf("%s does not exist in the output root", reference)
+	}
+	return ""
+}
+
+// checkReferences checks the asset references of the configs, materials
+// and layouts among paths, printing the broken ones, and returns how many
+// there were. References are rewritten first if rewriter is not nil, as
+// they were in the output.
+func checkReferences(source *Source, preprocessor *Preprocessor, rewriter *imageRewriter, paths []string, checker *referenceChecker) (int, error) {
+	problems := 0
+	for _, path := range paths {
+		if !isReferenceSource(path) {
+			continue
+		}
+		references, err := findReferences(source, preprocessor, path)
+		if err != nil {
+			return 0, err
+		}
+		for _, reference := range references {
+			if rewriter != nil {
+				reference.Path, _ = rewriter.Rewrite(reference.Path)
+			}
+			if problem := checker.Check(reference.Path); problem != "" {
+				fmt.Fprintf(os.Stderr, "❌ Broken     : %s: %s\n", reference.Pos, problem)
+				problems++
+			}
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigReferences(t *testing.T) {
+	config, err := ParseConfig("config.cpp", []byte(`class CfgVehicles {
+	class WLZ_Cupcake {
+		model = \WLZ\Anniversary\gear\cupcake.p3d;
+		displayName = "Cupcake";
+		icon = "set:dayz_inventory image:cupcake";
+		hiddenSelectionsTextures[] = {"WLZ\Anniversary\gear\data\cupcake_co.paa", {"nested/icing_ca.PAA"}};
+		class Materials {
+			rvmat = "WLZ\Anniversary\gear\data\cupcake.rvmat";
+			readme = "WLZ\Anniversary\readme.txt";
+		};
+	};
+};
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []AssetReference{
+		{Path: `\WLZ\Anniversary\gear\cupcake.p3d`, Pos: ConfigPos{File: "config.cpp", Line: 3}},
+		{Path: `WLZ\Anniversary\gear\data\cupcake_co.paa`, Pos: ConfigPos{File: "config.cpp", Line: 6}},
+		{Path: "nested/icing_ca.PAA", Pos: ConfigPos{File: "config.cpp", Line: 6}},
+		{Path: `WLZ\Anniversary\gear\data\cupcake.rvmat`, Pos: ConfigPos{File: "config.cpp", Line: 8}},
+	}, configReferences(config.Root))
+}
+
+func TestLayoutReferences(t *testing.T) {
+	layout := "FrameWidgetClass Root {\n" +
+		" {\n" +
+		"  ImageWidgetClass Logo {\n" +
+		"   image0 \"WLZ/Anniversary/gui/logo.edds\"\n" +
+		"   font \"gui/fonts/sdf_MetronBook24\" text \"Hello\"\n" +
+		"  }\n" +
+		" }\n" +
+		"}\n"
+
+	assert.Equal(t, []AssetReference{
+		{Path: "WLZ/Anniversary/gui/logo.edds", Pos: ConfigPos{File: "ui.layout", Line: 4}},
+	}, layoutReferences("ui.layout", []byte(layout)))
+}
+
+func TestReferenceChecker(t *testing.T) {
+	root := testFiles(t, map[string]string{
+		"WLZ/Core/data/shared_co.paa": "",
+	})
+	manifest := Manifest{
+		"gear/cupcake.p3d":         {SourcePath: "gear/cupcake.p3d"},
+		"gear/data/cupcake_co.png": {SourcePath: "gear/data/cupcake_co.png", OutputPath: "gear/data/cupcake_co.paa"},
+		"config.cpp":               {SourcePath: "config.cpp", OutputPath: "config.bin"},
+	}
+	checker := newReferenceChecker(`WLZ\Anniversary`, manifest, root, []string{"OtherMod/"})
+
+	tests := []struct {
+		reference string
+		problem   string
+	}{
+		{`WLZ\Anniversary\gear\cupcake.p3d`, ""},
+		{`\wlz\anniversary\GEAR\Cupcake.p3d`, ""},
+		{`WLZ/Anniversary/gear/data/cupcake_co.paa`, ""},
+		{`WLZ\Anniversary\gear\data\cupcake_co.png`, `WLZ\Anniversary\gear\data\cupcake_co.png is converted to .paa, reference the .paa instead`},
+		{`WLZ\Anniversary\gear\data\cupcake_ca.paa`, `WLZ\Anniversary\gear\data\cupcake_ca.paa is not in the addon`},
+		{`WLZ\Core\data\shared_co.paa`, ""},
+		{`WLZ\Core\data\missing_co.paa`, `WLZ\Core\data\missing_co.paa does not exist in the output root`},
+		{`DZ\gear\food\data\apple_co.paa`, ""},
+		{`\dz\characters\tops\data\shirt.rvmat`, ""},
+		{`OtherMod\data\thing.p3d`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.reference, func(t *testing.T) {
+			assert.Equal(t, test.problem, checker.Check(test.reference))
+		})
+	}
+}
+
+func TestFindReferences(t *testing.T) {
+	root := testFiles(t, map[string]string{
+		"config.cpp":         "#include \"macros.hpp\"\nclass CfgVehicles { class A { model = MODEL; }; };\n",
+		"macros.hpp":         "#define MODEL \"WLZ\\Anniversary\\a.p3d\"\n",
+		"data/a.rvmat":       "class Stage1 {\n\ttexture = \"WLZ\\Anniversary\\data\\a_nohq.paa\";\n};\n",
+		"data/broken.rvmat":  "class Stage1 {\n",
+		"gui/menu.layout":    "ImageWidgetClass A {\n image0 \"WLZ/Anniversary/gui/a.edds\"\n}\n",
+		"gui/data/notes.txt": "\"WLZ\\Anniversary\\b.p3d\"",
+	})
+	source := NewSource(root)
+	preprocessor := NewPreprocessor(root, `WLZ\Anniversary`)
+
+	references, err := findReferences(source, preprocessor, "config.cpp")
+	require.NoError(t, err)
+	assert.Equal(t, []AssetReference{{Path: `WLZ\Anniversary\a.p3d`, Pos: ConfigPos{File: "config.cpp", Line: 2}}}, references)
+
+	references, err = findReferences(source, preprocessor, "data/a.rvmat")
+	require.NoError(t, err)
+	assert.Equal(t, []AssetReference{{Path: `WLZ\Anniversary\data\a_nohq.paa`, Pos: ConfigPos{File: "data/a.rvmat", Line: 2}}}, references)
+
+	references, err = findReferences(source, preprocessor, "gui/menu.layout")
+	require.NoError(t, err)
+	assert.Equal(t, []AssetReference{{Path: "WLZ/Anniversary/gui/a.edds", Pos: ConfigPos{File: "gui/menu.layout", Line: 2}}}, references)
+
+	_, err = findReferences(source, preprocessor, "data/broken.rvmat")
+	assert.Error(t, err)
+
+	assert.False(t, isReferenceSource("gui/data/notes.txt"))
+	assert.True(t, isReferenceSource("data/A.RVMAT"))
+}
+
+func TestFindReferences_Rapified(t *testing.T) {
+	config, err := ParseConfig("a.rvmat", []byte("class Stage1 { texture = \"WLZ\\a_nohq.paa\"; };\n"))
+	require.NoError(t, err)
+	root := t.TempDir()
+	out, err := os.Create(filepath.Join(root, "a.rvmat"))
+	require.NoError(t, err)
+	require.NoError(t, Rapify(out, config))
+	require.NoError(t, out.Close())
+
+	references, err := findReferences(NewSource(root), NewPreprocessor(root, ""), "a.rvmat")
+	require.NoError(t, err)
+	assert.Equal(t, []AssetReference{{Path: `WLZ\a_nohq.paa`, Pos: ConfigPos{File: "a.rvmat"}}}, references)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// formatsToRewrite are the text assets in which references to converted
+// images are rewritten.
+var formatsToRewrite = []string{".cpp", ".imageset", ".layout", ".rvmat"}
+
+func shouldRewrite(path string) bool {
+	return slices.Contains(formatsToRewrite, strings.ToLower(filepath.Ext(path)))
+}
+
+var imageReferencePattern = regexp.MustCompile(`(?i)[\w\\/.\-]+\.(?:png|jpg)\b`)
+
+// imageRewriter rewrites references to images which are converted to .paa
+// by the build, such as WILDLANDZ\Anniversary\data\cupcake_co.png, to the
+// converted file.
+type imageRewriter struct {
+	// images maps the normalized references of the converted images to
+	// their source paths
+	images map[string]string
+}
+
+func newImageRewriter(prefix string, convert []string) *imageRewriter {
+	rewriter := &imageRewriter{images: map[string]string{}}
+	for _, path := range convert {
+		reference := strings.ReplaceAll(path, "/", `\`)
+		if prefix != "" {
+			reference = prefix + `\` + reference
+		}
+		rewriter.images[normalizeReference(reference)] = path
+	}
+	return rewriter
+}
+
+// SourceHash returns the source hash recorded for a config rapified with r,
+// which covers the images it rewrites, so that turning -rewrite-images on or
+// off, or converting other images, rapifies the config again. A nil r
+// returns sourceHash as it is.
+func (r *imageRewriter) SourceHash(sourceHash string) string {
+	if r == nil {
+		return sourceHash
+	}
+	images := slices.Sorted(maps.Values(r.images))
+	return hashData([]byte(sourceHash + "\trewrite-images\t" + strings.Join(images, "\t")))
+}
+
+// Rewrite returns text with the references to converted images replaced,
+// and the source paths of the images which were referenced.
+func (r *imageRewriter) Rewrite(text string) (string, []string) {
+	var images []string
+	text = imageReferencePattern.ReplaceAllStringFunc(text, func(reference string) string {
+		path, ok := r.images[normalizeReference(reference)]
+		if !ok {
+			return reference
+		}
+		if !slices.Contains(images, path) {
+			images = append(images, path)
+		}
+		return swapExtension(reference, ".paa")
+	})
+	return text, images
+}
+
+// RewriteConfig rewrites the references in the string values of class and
+// the classes it contains, and returns the source paths of the images which
+// were referenced.
+func (r *imageRewriter) RewriteConfig(class *ConfigClass) []string {
+	var images []string
+	var rewrite func(value *ConfigValue)
+	rewrite = func(value *ConfigValue) {
+		switch value.Type {
+		case ConfigString:
+			var referenced []string
+			value.String, referenced = r.Rewrite(value.String)
+			for _, path := range referenced {
+				if !slices.Contains(images, path) {
+					images = append(images, path)
+				}
+			}
+		case ConfigArray:
+			for i := range value.Array {
+				rewrite(&value.Array[i])
+			}
+		}
+	}
+
+	for i := range class.Entries {
+		entry := &class.Entries[i]
+		if entry.Kind == ConfigClassEntry {
+			for _, path := range r.RewriteConfig(entry.Class) {
+				if !slices.Contains(images, path) {
+					images = append(images, path)
+				}
+			}
+			continue
+		}
+		rewrite(&entry.Value)
+	}
+	return images
+}
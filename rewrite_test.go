@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageRewriter_Rewrite(t *testing.T) {
+	rewriter := newImageRewriter(`WLZ\Anniversary`, []string{"gear/data/cupcake_co.png", "gear/data/Cake_CA.JPG"})
+
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		images []string
+	}{
+		{
+			name:   "quoted path",
+			text:   `texture = "WLZ\Anniversary\gear\data\cupcake_co.png";`,
+			want:   `texture = "WLZ\Anniversary\gear\data\cupcake_co.paa";`,
+			images: []string{"gear/data/cupcake_co.png"},
+		},
+		{
+			name:   "leading backslash, case and separators",
+			text:   `\wlz\anniversary\GEAR/data/Cupcake_co.PNG`,
+			want:   `\wlz\anniversary\GEAR/data/Cupcake_co.paa`,
+			images: []string{"gear/data/cupcake_co.png"},
+		},
+		{
+			name:   "several references",
+			text:   "{\"WLZ\\Anniversary\\gear\\data\\cupcake_co.png\", \"WLZ\\Anniversary\\gear\\data\\cake_ca.jpg\", \"WLZ\\Anniversary\\gear\\data\\cupcake_co.png\"}",
+			want:   "{\"WLZ\\Anniversary\\gear\\data\\cupcake_co.paa\", \"WLZ\\Anniversary\\gear\\data\\cake_ca.paa\", \"WLZ\\Anniversary\\gear\\data\\cupcake_co.paa\"}",
+			images: []string{"gear/data/cupcake_co.png", "gear/data/Cake_CA.JPG"},
+		},
+		{
+			name: "images which are not converted",
+			text: `"WLZ\Anniversary\gear\data\other_co.png" "DZ\gear\data\cupcake_co.png" "gear\data\cupcake_co.png" "WLZ\Anniversary\gear\data\cupcake_co.pngx"`,
+			want: `"WLZ\Anniversary\gear\data\other_co.png" "DZ\gear\data\cupcake_co.png" "gear\data\cupcake_co.png" "WLZ\Anniversary\gear\data\cupcake_co.pngx"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, images := rewriter.Rewrite(test.text)
+			assert.Equal(t, test.want, text)
+			assert.Equal(t, test.images, images)
+		})
+	}
+}
+
+func TestImageRewriter_RewriteConfig(t *testing.T) {
+	config, err := ParseConfig("config.cpp", []byte(`class CfgVehicles {
+	class WLZ_Cupcake {
+		icon = "WLZ\Anniversary\gear\data\cupcake_co.png";
+		hiddenSelectionsTextures[] = {"WLZ\Anniversary\gear\data\cupcake_co.png", {"WLZ\Anniversary\gear\data\cake_co.png"}};
+		weight = 10;
+	};
+};
+`))
+	require.NoError(t, err)
+
+	rewriter := newImageRewriter(`WLZ\Anniversary`, []string{"gear/data/cupcake_co.png", "gear/data/cake_co.png"})
+	images := rewriter.RewriteConfig(config.Root)
+	assert.Equal(t, []string{"gear/data/cupcake_co.png", "gear/data/cake_co.png"}, images)
+
+	class := config.Root.Entries[0].Class.Entries[0].Class
+	assert.Equal(t, `WLZ\Anniversary\gear\data\cupcake_co.paa`, class.Entries[0].Value.String)
+	assert.Equal(t, `{"WLZ\Anniversary\gear\data\cupcake_co.paa", {"WLZ\Anniversary\gear\data\cake_co.paa"}}`, formatConfigValue(class.Entries[1].Value))
+	assert.Equal(t, int32(10), class.Entries[2].Value.Int)
+}
+
+func TestRapifyFile_Rewrite(t *testing.T) {
+	root := testFiles(t, map[string]string{
+		"config.cpp": "class A { texture = \"WLZ\\data\\a_co.png\"; };\n",
+	})
+	dst := filepath.Join(root, "out", "config.bin")
+
+	dependencies, err := rapifyFile(NewPreprocessor(root, "WLZ"), newImageRewriter("WLZ", []string{"data/a_co.png"}), "config.cpp", dst)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data/a_co.png"}, dependencies)
+
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	config, err := Derapify(data)
+	require.NoError(t, err)
+	assert.Equal(t, `WLZ\data\a_co.paa`, config.Root.Entries[0].Class.Entries[0].Value.String)
+}
+
+func TestImageRewriter_SourceHash(t *testing.T) {
+	var none *imageRewriter
+	assert.Equal(t, "0123456789abcdef", none.SourceHash("0123456789abcdef"))
+
+	rewriter := newImageRewriter(`WLZ\Anniversary`, []string{"gear/data/cupcake_co.png"})
+	hash := rewriter.SourceHash("0123456789abcdef")
+	assert.NotEqual(t, "0123456789abcdef", hash)
+	assert.Equal(t, hash, rewriter.SourceHash("0123456789abcdef"))
+
+	other := newImageRewriter(`WLZ\Anniversary`, []string{"gear/data/cupcake_co.png", "gear/data/cake_co.png"})
+	assert.NotEqual(t, hash, other.SourceHash("0123456789abcdef"))
+}
@@ -36,12 +36,15 @@ type Task struct {
 	Manifest Manifest
 	Copy     []string
 	Convert  []string
+
+	// ModManifest and ModCopy track the contents of root level directories
+	// starting with _, which are copied verbatim to the mod folder.
+	ModManifest Manifest
+	ModCopy     []string
 }
 
 func (s *Source) Prepare() (*Task, error) {
-	task := &Task{Manifest: make(Manifest), Copy: []string{}}
-
-	hash := fnv.New64a()
+	task := &Task{Manifest: make(Manifest), Copy: []string{}, ModManifest: make(Manifest), ModCopy: []string{}}
 
 	err := fs.WalkDir(os.DirFS(s.path), ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -53,6 +56,20 @@ func (s *Source) Prepare() (*Task, error) {
 		}
 
 		if strings.HasPrefix(path, "_") {
+			// files at the root are skipped, directories are mod folder payload
+			if !strings.Contains(path, "/") {
+				return nil
+			}
+			hash, err := s.hash(path)
+			if err != nil {
+				return err
+			}
+			outputPath, err := modPath(path)
+			if err != nil {
+				return err
+			}
+			task.ModCopy = append(task.ModCopy, path)
+			task.ModManifest[path] = ManifestEntry{SourcePath: path, SourceHash: hash, OutputPath: outputPath}
 			return nil
 		}
 
@@ -69,18 +86,11 @@ func (s *Source) Prepare() (*Task, error) {
 			return nil
 		}
 
-		f, err := os.Open(s.RealPath(path))
-		if err != nil {
-			return fmt.Errorf("error opening input file %q: %w", path, err)
-		}
-		defer f.Close()
-
-		hash.Reset()
-		_, err = io.Copy(hash, f)
+		hash, err := s.hash(path)
 		if err != nil {
-			return fmt.Errorf("error hashing input file %q: %w", path, err)
+			return err
 		}
-		task.Manifest[path] = ManifestEntry{SourcePath: path, SourceHash: fmt.Sprintf("%x", hash.Sum(nil))}
+		task.Manifest[path] = ManifestEntry{SourcePath: path, SourceHash: hash}
 
 		return nil
 	})
@@ -88,6 +98,70 @@ func (s *Source) Prepare() (*Task, error) {
 	return task, err
 }
 
+func (s *Source) hash(path string) (string, error) {
+	hash := fnv.New64a()
+
+	f, err := os.Open(s.RealPath(path))
+	if err != nil {
+		return "", fmt.Errorf("error opening input file %q: %w", path, err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", fmt.Errorf("error hashing input file %q: %w", path, err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Dependencies returns the paths with their current hashes.
+func (s *Source) Dependencies(paths []string) ([]ManifestDependency, error) {
+	dependencies := []ManifestDependency{}
+	for _, path := range paths {
+		hash, err := s.hash(path)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, ManifestDependency{Path: path, Hash: hash})
+	}
+	return dependencies, nil
+}
+
+// DependenciesChanged reports whether any of the dependencies has changed
+// or been removed since it was hashed.
+func (s *Source) DependenciesChanged(dependencies []ManifestDependency) bool {
+	for _, dependency := range dependencies {
+		hash, err := s.hash(dependency.Path)
+		if err != nil || hash != dependency.Hash {
+			return true
+		}
+	}
+	return false
+}
+
+// modPath maps a path in a root level _ directory to its location in the mod
+// folder, by dropping the underscore from the name of that directory only
+// (_keys/a.bikey -> keys/a.bikey). The rest of the path is kept as is.
+func modPath(path string) (string, error) {
+	dir, rest, _ := strings.Cut(path, "/")
+	name := strings.TrimPrefix(dir, "_")
+	if name == "" {
+		return "", fmt.Errorf("error: mod folder directory %q has no name after the leading _", dir)
+	}
+	return name + "/" + rest, nil
+}
+
+// Prefix returns the addon prefix from the prefix file in the source
+// directory, or an empty string if there is none.
+func (s *Source) Prefix() (string, error) {
+	prefix, err := readPrefixFile(s.RealPath(prefixFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return prefix, err
+}
+
 func (s *Source) RealPath(path string) string {
 	return filepath.Join(s.path, path)
 }
@@ -238,4 +238,76 @@ func TestSource_Prepare(t *testing.T) {
 		assert.Contains(t, task.Convert, "image.png")
 		assert.Contains(t, task.Convert, "photo.jpg")
 	})
+
+	t.Run("collects root level underscore directories as mod folder payload", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		files := []string{
+			"_keys/WILDLANDZ.bikey",
+			"_extras/readme.md",
+			"_extras/_notes/todo.md",
+			"_skipped.cpp",
+			"config.cpp",
+		}
+
+		for _, file := range files {
+			filePath := filepath.Join(tmpDir, file)
+			err := os.MkdirAll(filepath.Dir(filePath), 0755)
+			require.NoError(t, err)
+			err = os.WriteFile(filePath, []byte("content"), 0644)
+			require.NoError(t, err)
+		}
+
+		source := NewSource(tmpDir)
+		task, err := source.Prepare()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"config.cpp"}, task.Copy)
+		assert.ElementsMatch(t, []string{"_extras/_notes/todo.md", "_extras/readme.md", "_keys/WILDLANDZ.bikey"}, task.ModCopy)
+		assert.Len(t, task.Manifest, 1)
+		assert.Len(t, task.ModManifest, 3)
+
+		entry := task.ModManifest["_keys/WILDLANDZ.bikey"]
+		assert.Equal(t, "keys/WILDLANDZ.bikey", entry.OutputPath)
+		assert.Len(t, entry.SourceHash, 16)
+		assert.Equal(t, "extras/_notes/todo.md", task.ModManifest["_extras/_notes/todo.md"].OutputPath)
+	})
+
+	t.Run("rejects mod folder directories without a name", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "_"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "_", "readme.md"), []byte("content"), 0644))
+
+		_, err := NewSource(tmpDir).Prepare()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no name")
+	})
+}
+
+func TestSource_Dependencies(t *testing.T) {
+	t.Run("detects changed and removed dependencies", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "macros.hpp"), []byte("#define A 1"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "classes.hpp"), []byte("class A {};"), 0644))
+
+		source := NewSource(tmpDir)
+		dependencies, err := source.Dependencies([]string{"macros.hpp", "classes.hpp"})
+		require.NoError(t, err)
+		require.Len(t, dependencies, 2)
+		assert.Equal(t, "macros.hpp", dependencies[0].Path)
+		assert.False(t, source.DependenciesChanged(dependencies))
+
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "macros.hpp"), []byte("#define A 2"), 0644))
+		assert.True(t, source.DependenciesChanged(dependencies))
+
+		dependencies, err = source.Dependencies([]string{"macros.hpp", "classes.hpp"})
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(filepath.Join(tmpDir, "classes.hpp")))
+		assert.True(t, source.DependenciesChanged(dependencies))
+	})
+
+	t.Run("fails for missing files", func(t *testing.T) {
+		_, err := NewSource(t.TempDir()).Dependencies([]string{"missing.hpp"})
+		assert.Error(t, err)
+	})
 }
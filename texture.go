@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// TextureProfile controls how an image with a given suffix is encoded.
+type TextureProfile struct {
+	// Suffix is the end of the file name stem, such as _co
+	Suffix string
+	// Format is auto (DXT1 for opaque images, DXT5 otherwise), dxt1 (alpha
+	// is discarded) or dxt5
+	Format string
+	// Filter is the mipmap filter: box, normalmap (renormalises normals)
+	// or fadeout (fades detail textures to grey)
+	Filter string
+}
+
+var (
+	textureFormats = []string{"auto", "dxt1", "dxt5"}
+	textureFilters = []string{"box", "normalmap", "fadeout"}
+)
+
+// defaultTextureProfile is used for images without a recognised suffix.
+var defaultTextureProfile = TextureProfile{Format: "auto", Filter: "box"}
+
+var defaultTextureProfiles = TextureProfiles{
+	{Suffix: "_co", Format: "dxt1", Filter: "box"},
+	{Suffix: "_ca", Format: "dxt5", Filter: "box"},
+	{Suffix: "_nohq", Format: "dxt5", Filter: "normalmap"},
+	{Suffix: "_smdi", Format: "dxt5", Filter: "box"},
+	{Suffix: "_as", Format: "dxt5", Filter: "box"},
+	{Suffix: "_mc", Format: "dxt5", Filter: "box"},
+	{Suffix: "_dt", Format: "dxt5", Filter: "fadeout"},
+}
+
+// TextureProfiles is a suffix to profile table. It implements flag.Value,
+// where each value is suffix=format[,filter] and replaces any existing
+// profile for the suffix.
+type TextureProfiles []TextureProfile
+
+func (p *TextureProfiles) String() string {
+	if p == nil {
+		return ""
+	}
+	values := []string{}
+	for _, profile := range *p {
+		values = append(values, fmt.Sprintf("%s=%s,%s", profile.Suffix, profile.Format, profile.Filter))
+	}
+	return strings.Join(values, " ")
+}
+
+func (p *TextureProfiles) Set(value string) error {
+	suffix, settings, ok := strings.Cut(value, "=")
+	if !ok || !strings.HasPrefix(suffix, "_") {
+		return fmt.Errorf("invalid texture profile %q, expected _suffix=format[,filter]", value)
+	}
+	profile := TextureProfile{Suffix: strings.ToLower(suffix), Filter: "box"}
+	format, filter, hasFilter := strings.Cut(settings, ",")
+	profile.Format = strings.ToLower(format)
+	if hasFilter {
+		profile.Filter = strings.ToLower(filter)
+	}
+	if !slices.Contains(textureFormats, profile.Format) {
+		return fmt.Errorf("invalid texture format %q, expected one of %s", format, strings.Join(textureFormats, ", "))
+	}
+	if !slices.Contains(textureFilters, profile.Filter) {
+		return fmt.Errorf("invalid mipmap filter %q, expected one of %s", filter, strings.Join(textureFilters, ", "))
+	}
+
+	for i := range *p {
+		if (*p)[i].Suffix == profile.Suffix {
+			(*p)[i] = profile
+			return nil
+		}
+	}
+	*p = append(*p, profile)
+	return nil
+}
+
+// Match returns the profile for the suffix of path, or the default profile
+// and false if the suffix is not recognised.
+func (p TextureProfiles) Match(path string) (TextureProfile, bool) {
+	suffix := textureSuffix(path)
+	for _, profile := range p {
+		if profile.Suffix == suffix {
+			return profile, true
+		}
+	}
+	return defaultTextureProfile, false
+}
+
+// textureSuffix returns the lower cased suffix of a texture path, from the
+// last underscore of the file name stem (cupcake_co.png -> _co).
+func textureSuffix(path string) string {
+	stem := strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	i := strings.LastIndex(stem, "_")
+	if i < 0 {
+		return ""
+	}
+	return stem[i:]
+}
+
+// filterMipmap applies the profile's mipmap filter to a downsampled level.
+func filterMipmap(img *image.NRGBA, filter string) {
+	switch filter {
+	case "normalmap":
+		for i := 0; i < len(img.Pix); i += 4 {
+			var v [3]float64
+			length := 0.0
+			for k := 0; k < 3; k++ {
+				v[k] = float64(img.Pix[i+k])/127.5 - 1
+				length += v[k] * v[k]
+			}
+			length = math.Sqrt(length)
+			if length == 0 {
+				continue
+			}
+			for k := 0; k < 3; k++ {
+				img.Pix[i+k] = uint8(math.Round((v[k]/length + 1) * 127.5))
+			}
+		}
+	case "fadeout":
+		// each level moves a quarter of the remaining way to neutral grey
+		for i := 0; i < len(img.Pix); i += 4 {
+			for k := 0; k < 3; k++ {
+				img.Pix[i+k] = uint8((int(img.Pix[i+k])*3 + 128 + 2) / 4)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextureProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected TextureProfile
+		ok       bool
+	}{
+		{"colour", "data/cupcake_co.png", TextureProfile{Suffix: "_co", Format: "dxt1", Filter: "box"}, true},
+		{"colour with alpha", "data/cupcake_CA.png", TextureProfile{Suffix: "_ca", Format: "dxt5", Filter: "box"}, true},
+		{"normal map", "data/cupcake_nohq.jpg", TextureProfile{Suffix: "_nohq", Format: "dxt5", Filter: "normalmap"}, true},
+		{"detail", "data/ground_dt.png", TextureProfile{Suffix: "_dt", Format: "dxt5", Filter: "fadeout"}, true},
+		{"unknown suffix", "data/cupcake_xx.png", defaultTextureProfile, false},
+		{"no suffix", "data/cupcake.png", defaultTextureProfile, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, ok := defaultTextureProfiles.Match(test.path)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, profile)
+		})
+	}
+
+	t.Run("set replaces and adds profiles", func(t *testing.T) {
+		profiles := slices.Clone(defaultTextureProfiles)
+		require.NoError(t, profiles.Set("_co=dxt5"))
+		require.NoError(t, profiles.Set("_sky=auto,fadeout"))
+		assert.Len(t, profiles, len(defaultTextureProfiles)+1)
+
+		profile, ok := profiles.Match("sky_co.png")
+		assert.True(t, ok)
+		assert.Equal(t, TextureProfile{Suffix: "_co", Format: "dxt5", Filter: "box"}, profile)
+
+		profile, ok = profiles.Match("clouds_sky.png")
+		assert.True(t, ok)
+		assert.Equal(t, TextureProfile{Suffix: "_sky", Format: "auto", Filter: "fadeout"}, profile)
+
+		assert.Equal(t, "dxt1", defaultTextureProfiles[0].Format)
+	})
+
+	t.Run("set rejects invalid profiles", func(t *testing.T) {
+		profiles := TextureProfiles{}
+		for _, value := range []string{"_co", "co=dxt1", "_co=dxt3", "_co=dxt1,lanczos"} {
+			assert.Error(t, profiles.Set(value), value)
+		}
+		assert.Empty(t, profiles)
+	})
+}
+
+func TestConversionHash(t *testing.T) {
+	co := TextureProfile{Suffix: "_co", Format: "dxt1", Filter: "box"}
+	builtin := convertFunc(encodePAAFile)
+	hash := conversionHash("0123456789abcdef", "builtin", builtin, co)
+
+	assert.Len(t, hash, 16)
+	assert.Equal(t, hash, conversionHash("0123456789abcdef", "builtin", builtin, co))
+	assert.NotEqual(t, hash, conversionHash("fedcba9876543210", "builtin", builtin, co), "image changed")
+	assert.NotEqual(t, hash, conversionHash("0123456789abcdef", "builtin", builtin, TextureProfile{Suffix: "_co", Format: "dxt5", Filter: "box"}), "profile changed")
+
+	imageToPAA := execConverter("/opt/DayZ Tools/ImageToPAA", converterConfig{})
+	hash = conversionHash("0123456789abcdef", "image-to-paa", imageToPAA, TextureProfile{})
+	assert.NotEqual(t, hash, conversionHash("0123456789abcdef", "image-to-paa", execConverter("/opt/DayZ Tools 2/ImageToPAA", converterConfig{}), TextureProfile{}), "executable changed")
+
+	command, err := newCommandConverter(converterConfig{command: "wine ImageToPAA.exe {src:win} {dst:win}"})
+	require.NoError(t, err)
+	hash = conversionHash("0123456789abcdef", "command", command, TextureProfile{})
+	other, err := newCommandConverter(converterConfig{command: "wine ImageToPAA.exe -size=1024 {src:win} {dst:win}"})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, conversionHash("0123456789abcdef", "command", other, TextureProfile{}), "command changed")
+	assert.NotEqual(t, hash, conversionHash("0123456789abcdef", "image-to-paa", command, TextureProfile{}), "converter changed")
+}
+
+func TestFilterMipmap(t *testing.T) {
+	t.Run("renormalises normal maps", func(t *testing.T) {
+		img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		copy(img.Pix, []uint8{128, 128, 191, 255})
+		filterMipmap(img, "normalmap")
+		for i, expected := range []uint8{128, 128, 255, 255} {
+			assert.InDelta(t, expected, img.Pix[i], 1)
+		}
+	})
+
+	t.Run("fades detail textures to grey", func(t *testing.T) {
+		img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		copy(img.Pix, []uint8{0, 128, 255, 255})
+		filterMipmap(img, "fadeout")
+		assert.Equal(t, []uint8{32, 128, 223, 255}, img.Pix)
+	})
+}
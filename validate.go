@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateImage checks that the image at src can be converted to a PAA, and
+// returns a description of each problem found. The texture suffix of name
+// decides whether alpha is expected.
+func validateImage(src, name string, maxSize int) ([]string, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".jpg" || ext == ".jpeg" {
+		precision, components, err := jpegFrame(data)
+		if err != nil {
+			return append(problems, err.Error()), nil
+		}
+		if precision != 8 {
+			problems = append(problems, fmt.Sprintf("%d-bit JPEG, only 8-bit JPEGs are supported", precision))
+		}
+		if components == 4 {
+			problems = append(problems, "CMYK JPEG, convert it to RGB")
+		}
+		if len(problems) > 0 {
+			return problems, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return append(problems, fmt.Sprintf("cannot be decoded: %v", err)), nil
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if !isPowerOfTwo(width) || !isPowerOfTwo(height) {
+		problems = append(problems, fmt.Sprintf("dimensions %dx%d are not powers of two", width, height))
+	}
+	if width > maxSize || height > maxSize {
+		problems = append(problems, fmt.Sprintf("dimensions %dx%d exceed the maximum of %d", width, height, maxSize))
+	}
+
+	switch textureSuffix(name) {
+	case "_co":
+		if hasAlpha(toNRGBA(img)) {
+			problems = append(problems, "_co texture has alpha, which will be discarded (use _ca for textures with alpha)")
+		}
+	case "_ca":
+		if !hasAlpha(toNRGBA(img)) {
+			problems = append(problems, "_ca texture has no alpha (use _co for opaque textures)")
+		}
+	}
+	return problems, nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// jpegFrame returns the sample precision and number of components from the
+// start of frame segment of a JPEG.
+func jpegFrame(data []byte) (int, int, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return 0, 0, fmt.Errorf("not a JPEG file")
+	}
+
+	for {
+		var marker [2]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return 0, 0, fmt.Errorf("JPEG has no frame header")
+		}
+		if marker[0] != 0xff {
+			return 0, 0, fmt.Errorf("JPEG is corrupt")
+		}
+		if marker[1] == 0xff || (marker[1] >= 0xd0 && marker[1] <= 0xd7) || marker[1] == 0x01 {
+			// padding and markers without a length
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return 0, 0, fmt.Errorf("JPEG is corrupt")
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return 0, 0, fmt.Errorf("JPEG is truncated")
+		}
+
+		// SOF0-SOF15, except DHT (c4), JPG (c8) and DAC (cc)
+		if marker[1] >= 0xc0 && marker[1] <= 0xcf && marker[1] != 0xc4 && marker[1] != 0xc8 && marker[1] != 0xcc {
+			if len(segment) < 6 {
+				return 0, 0, fmt.Errorf("JPEG frame header is truncated")
+			}
+			return int(segment[0]), int(segment[5]), nil
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		img      image.Image
+		expected []string
+	}{
+		{"valid colour texture", "cupcake_co.png", testImage(64, 32, 0xff), []string{}},
+		{"valid alpha texture", "cupcake_ca.png", testImage(16, 16, 0x80), []string{}},
+		{"not a power of two", "cupcake_co.png", testImage(48, 32, 0xff), []string{"dimensions 48x32 are not powers of two"}},
+		{"too large", "cupcake_co.png", testImage(128, 16, 0xff), []string{"dimensions 128x16 exceed the maximum of 64"}},
+		{"alpha on _co", "cupcake_co.png", testImage(16, 16, 0x80), []string{"_co texture has alpha, which will be discarded (use _ca for textures with alpha)"}},
+		{"no alpha on _ca", "cupcake_ca.png", testImage(16, 16, 0xff), []string{"_ca texture has no alpha (use _co for opaque textures)"}},
+		{"all problems at once", "cupcake_ca.png", testImage(96, 16, 0xff), []string{
+			"dimensions 96x16 are not powers of two",
+			"dimensions 96x16 exceed the maximum of 64",
+			"_ca texture has no alpha (use _co for opaque textures)",
+		}},
+		{"valid jpeg", "cupcake_co.jpg", testImage(16, 16, 0xff), []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), test.file)
+			f, err := os.Create(src)
+			require.NoError(t, err)
+			if filepath.Ext(test.file) == ".jpg" {
+				require.NoError(t, jpeg.Encode(f, test.img, nil))
+			} else {
+				require.NoError(t, png.Encode(f, test.img))
+			}
+			require.NoError(t, f.Close())
+
+			problems, err := validateImage(src, "data/"+test.file, 64)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, problems)
+		})
+	}
+
+	t.Run("rejects CMYK and 12-bit JPEGs", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "cupcake_co.jpg")
+		require.NoError(t, os.WriteFile(src, testJPEGFrame(12, 4), 0644))
+
+		problems, err := validateImage(src, "cupcake_co.jpg", 4096)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"12-bit JPEG, only 8-bit JPEGs are supported", "CMYK JPEG, convert it to RGB"}, problems)
+	})
+
+	t.Run("reports images which cannot be decoded", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "cupcake_co.png")
+		require.NoError(t, os.WriteFile(src, []byte("not a png"), 0644))
+
+		problems, err := validateImage(src, "cupcake_co.png", 4096)
+		require.NoError(t, err)
+		require.Len(t, problems, 1)
+		assert.Contains(t, problems[0], "cannot be decoded")
+	})
+}
+
+// testJPEGFrame returns the start of a JPEG up to its frame header.
+func testJPEGFrame(precision, components byte) []byte {
+	data := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00}
+	length := byte(8 + 3*components)
+	data = append(data, 0xff, 0xc0, 0x00, length, precision, 0x00, 0x10, 0x00, 0x10, components)
+	for i := byte(0); i < components; i++ {
+		data = append(data, i+1, 0x11, 0x00)
+	}
+	return data
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newVerifySignatureCommand() *ffcli.Command {
+	flags := flag.NewFlagSet("mod-build verify-signature", flag.ExitOnError)
+	var keys keyPaths
+	flags.Var(&keys, "key", "Path to a .bikey, or a directory of them, to accept signatures from, may be repeated (defaults to the keys directory of the mod folder)")
+
+	return &ffcli.Command{
+		Name:       "verify-signature",
+		ShortUsage: "mod-build verify-signature [options] <mod-folder>",
+		ShortHelp:  "Check the signatures of the PBOs in a mod folder",
+		LongHelp: "Check the .bisign signatures of every PBO in a mod folder against the keys a\n" +
+			"server accepts, as the server does when a client joins. PBOs which are\n" +
+			"unsigned, signed with an unknown key, or changed since they were signed are\n" +
+			"reported.",
+		UsageFunc: usage,
+		FlagSet:   flags,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				fmt.Fprintln(os.Stderr, "error: mod folder is required")
+				fmt.Fprintln(os.Stderr, "")
+				return flag.ErrHelp
+			}
+			return verifySignatures(args[0], keys)
+		},
+	}
+}
+
+// keyPaths is a list of key files or directories given by a repeated flag.
+type keyPaths []string
+
+func (k *keyPaths) String() string {
+	if k == nil {
+		return ""
+	}
+	return strings.Join(*k, ", ")
+}
+
+func (k *keyPaths) Set(value string) error {
+	*k = append(*k, value)
+	return nil
+}
+
+// loadBIKeys reads the .bikey files at paths, and in the directories among
+// them.
+func loadBIKeys(paths []string) ([]*BIKey, error) {
+	var keys []*BIKey
+	for _, path := range paths {
+		finfo, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{path}
+		if finfo.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = nil
+			for _, entry := range entries {
+				if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".bikey") {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			key, err := DecodeBIKey(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %q: %w", file, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func verifySignatures(modDir string, keyPaths []string) error {
+	if len(keyPaths) == 0 {
+		keyPaths = []string{filepath.Join(modDir, "keys")}
+	}
+	keys, err := loadBIKeys(keyPaths)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error: %w (set the keys to check against with -key)", err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("error: no .bikey files in %s", strings.Join(keyPaths, ", "))
+	}
+	for _, key := range keys {
+		fmt.Printf("🔑 Key        : %s\n", key.Authority)
+	}
+
+	var pbos, signatures []string
+	err = filepath.WalkDir(modDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".pbo":
+			pbos = append(pbos, path)
+		case ".bisign":
+			signatures = append(signatures, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	for _, pboPath := range pbos {
+		var pboSignatures []string
+		signatures = slices.DeleteFunc(signatures, func(signature string) bool {
+			if strings.HasPrefix(strings.ToLower(signature), strings.ToLower(pboPath)+".") {
+				pboSignatures = append(pboSignatures, signature)
+				return true
+			}
+			return false
+		})
+
+		verified, err := verifyPBOSignatures(modDir, pboPath, pboSignatures, keys)
+		if err != nil {
+			return err
+		}
+		if !verified {
+			problems++
+		}
+	}
+	for _, signature := range signatures {
+		fmt.Fprintf(os.Stderr, "⚠️ No PBO for %q\n", relativePath(modDir, signature))
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d PBOs without a valid signature", problems)
+	}
+	return nil
+}
+
+// verifyPBOSignatures prints whether each of the signatures of the PBO at
+// pboPath is valid, and reports whether any of them was.
+func verifyPBOSignatures(modDir, pboPath string, signatures []string, keys []*BIKey) (bool, error) {
+	if len(signatures) == 0 {
+		fmt.Fprintf(os.Stderr, "❌ Unsigned   : %q\n", relativePath(modDir, pboPath))
+		return false, nil
+	}
+
+	f, err := os.Open(pboPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	pbo, err := NewPBOReader(f)
+	if err != nil {
+		return false, fmt.Errorf("error reading %q: %w", pboPath, err)
+	}
+
+	verified := false
+	for _, path := range signatures {
+		name := relativePath(modDir, path)
+		signature, err := readBISignatureFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Invalid    : %q: %v\n", name, err)
+			continue
+		}
+		if !slices.ContainsFunc(keys, func(key *BIKey) bool { return key.Key.Equal(signature.Key.Key) }) {
+			fmt.Fprintf(os.Stderr, "❌ Unknown key: %q: signed with a key of %s which is not among the keys\n", name, signature.Key.Authority)
+			continue
+		}
+		valid, err := signature.Verify(pbo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Invalid    : %q: %v\n", name, err)
+			continue
+		}
+		if !valid {
+			fmt.Fprintf(os.Stderr, "❌ Mismatch   : %q: the PBO was changed after it was signed\n", name)
+			continue
+		}
+		fmt.Printf("✅ Verified   : %q (%s, version %d)\n", name, signature.Key.Authority, signature.Version)
+		verified = true
+	}
+	return verified, nil
+}
+
+// readBISignatureFile reads the .bisign at path.
+func readBISignatureFile(path string) (*BISignature, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeBISignature(f)
+}
+
+// relativePath returns path relative to root for printing, or path itself
+// if it is not below root.
+func relativePath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
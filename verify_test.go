@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignatures(t *testing.T) {
+	keysDir := t.TempDir()
+	require.NoError(t, keygen("WLZ", keysDir, nil))
+	require.NoError(t, keygen("Other", keysDir, nil))
+	key, err := readBIPrivateKeyFile(filepath.Join(keysDir, "WLZ.biprivatekey"), passphraseSource{})
+	require.NoError(t, err)
+	other, err := readBIPrivateKeyFile(filepath.Join(keysDir, "Other.biprivatekey"), passphraseSource{})
+	require.NoError(t, err)
+
+	addon := testFiles(t, map[string]string{"config.cpp": "class A {};"})
+	modDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		require.NoError(t, pack(addon, filepath.Join(dir, "addons", "WLZ_A.pbo"), `WLZ\A`, "", passphraseSource{}))
+		require.NoError(t, saveBIKey(filepath.Join(dir, "keys", "WLZ.bikey"), key.Public()))
+		return dir
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, dir string)
+		keys     []string
+		expected string
+	}{
+		{
+			name: "signed",
+			setup: func(t *testing.T, dir string) {
+				_, err := signPBOFile(filepath.Join(dir, "addons", "WLZ_A.pbo"), key)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "unsigned",
+			setup:    func(t *testing.T, dir string) {},
+			expected: "found 1 PBOs without a valid signature",
+		},
+		{
+			name: "unknown key",
+			setup: func(t *testing.T, dir string) {
+				_, err := signPBOFile(filepath.Join(dir, "addons", "WLZ_A.pbo"), other)
+				require.NoError(t, err)
+			},
+			expected: "found 1 PBOs without a valid signature",
+		},
+		{
+			name: "unknown key with a valid signature",
+			setup: func(t *testing.T, dir string) {
+				for _, key := range []*BIPrivateKey{key, other} {
+					_, err := signPBOFile(filepath.Join(dir, "addons", "WLZ_A.pbo"), key)
+					require.NoError(t, err)
+				}
+			},
+		},
+		{
+			name: "changed after signing",
+			setup: func(t *testing.T, dir string) {
+				pboPath := filepath.Join(dir, "addons", "WLZ_A.pbo")
+				_, err := signPBOFile(pboPath, key)
+				require.NoError(t, err)
+				require.NoError(t, pack(testFiles(t, map[string]string{"config.cpp": "class B {};"}), pboPath, `WLZ\A`, "", passphraseSource{}))
+			},
+			expected: "found 1 PBOs without a valid signature",
+		},
+		{
+			name: "keys given",
+			setup: func(t *testing.T, dir string) {
+				_, err := signPBOFile(filepath.Join(dir, "addons", "WLZ_A.pbo"), other)
+				require.NoError(t, err)
+			},
+			keys: []string{filepath.Join(keysDir, "Other.bikey")},
+		},
+		{
+			name: "no keys",
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, os.RemoveAll(filepath.Join(dir, "keys")))
+			},
+			expected: "-key",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := modDir(t)
+			test.setup(t, dir)
+
+			err := verifySignatures(dir, test.keys)
+			if test.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.expected)
+			}
+		})
+	}
+}
+
+func TestVerifySignatures_Fixture(t *testing.T) {
+	pbo, err := os.ReadFile(filepath.Join("testdata", "WLZ_Fixture.pbo"))
+	require.NoError(t, err)
+	signature, err := os.ReadFile(filepath.Join("testdata", "WLZ_Fixture.pbo.WLZ_Fixture.bisign"))
+	require.NoError(t, err)
+	key, err := os.ReadFile(filepath.Join("testdata", "WLZ_Fixture.bikey"))
+	require.NoError(t, err)
+
+	modDir := func(t *testing.T, pbo []byte) string {
+		return testFiles(t, map[string]string{
+			"addons/WLZ_Fixture.pbo":                    string(pbo),
+			"addons/WLZ_Fixture.pbo.WLZ_Fixture.bisign": string(signature),
+			"keys/WLZ_Fixture.bikey":                    string(key),
+		})
+	}
+
+	t.Run("accepts the fixture", func(t *testing.T) {
+		assert.NoError(t, verifySignatures(modDir(t, pbo), nil))
+	})
+
+	t.Run("rejects the fixture with a changed script", func(t *testing.T) {
+		changed := bytes.Replace(pbo, []byte(`hint "fixture";`), []byte(`hint "changed";`), 1)
+		require.NotEqual(t, pbo, changed)
+		assert.ErrorContains(t, verifySignatures(modDir(t, changed), nil), "found 1 PBOs without a valid signature")
+	})
+}
+
+func TestLoadBIKeys(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, keygen("WLZ", dir, nil))
+	require.NoError(t, keygen("Other", filepath.Join(dir, "other"), nil))
+
+	keys, err := loadBIKeys([]string{dir, filepath.Join(dir, "other", "Other.bikey")})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "WLZ", keys[0].Authority)
+	assert.Equal(t, "Other", keys[1].Authority)
+
+	_, err = loadBIKeys([]string{filepath.Join(dir, "WLZ.biprivatekey")})
+	assert.Error(t, err)
+}